@@ -0,0 +1,193 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bvkgo/kvtests/txtest"
+)
+
+// Anomaly identifies a transaction isolation anomaly.
+type Anomaly int
+
+const (
+	DirtyWrite Anomaly = iota
+	DirtyRead
+	LostUpdate
+	ReadSkew
+	WriteSkew
+	NonRepeatableRead
+	Phantom
+	ReadOnlyAnomaly
+)
+
+var anomalyNames = []string{
+	DirtyWrite:        "dirty-write",
+	DirtyRead:         "dirty-read",
+	LostUpdate:        "lost-update",
+	ReadSkew:          "read-skew",
+	WriteSkew:         "write-skew",
+	NonRepeatableRead: "non-repeatable-read",
+	Phantom:           "phantom",
+	ReadOnlyAnomaly:   "read-only-anomaly",
+}
+
+func (a Anomaly) String() string {
+	if a < 0 || int(a) >= len(anomalyNames) {
+		return fmt.Sprintf("Anomaly(%d)", int(a))
+	}
+	return anomalyNames[a]
+}
+
+// anomalySteps holds a test for each anomaly. Every test is designed so that
+// the outcome is not serializable only when the backend permits the anomaly.
+var anomalySteps = map[Anomaly][]string{
+	DirtyWrite: {
+		"t0: begin",
+		"t1: begin",
+		"t0: set-k0-t0",
+		"t1: set-k0-t1",
+		"t1: set-k1-t1",
+		"t0: set-k1-t0",
+		"t0: commit",
+		"t1: commit",
+	},
+	DirtyRead: {
+		"t0: begin",
+		"t1: begin",
+		"t0: set-k0-t0",
+		"t1: get-k0",
+		"t0: abort",
+		"t1: commit",
+	},
+	LostUpdate: {
+		"t0: begin",
+		"t1: begin",
+		"t0: get-k0",
+		"t1: get-k0",
+		"t0: set-k0-t0",
+		"t1: set-k0-t1",
+		"t0: commit",
+		"t1: commit",
+	},
+	ReadSkew: {
+		"t0: begin",
+		"t1: begin",
+		"t0: get-k0",
+		"t1: set-k0-t1",
+		"t1: set-k1-t1",
+		"t1: commit",
+		"t0: get-k1",
+		"t0: commit",
+	},
+	WriteSkew: skewedWritesSteps,
+	NonRepeatableRead: {
+		"t0: begin",
+		"t1: begin",
+		"t0: get-k0",
+		"t1: set-k0-t1",
+		"t1: commit",
+		"t0: get-k0",
+		"t0: commit",
+	},
+	Phantom: {
+		// Remove k1 so that it can be inserted into the range later.
+		"t0: begin",
+		"t0: delete-k1",
+		"t0: commit",
+
+		"t1: begin",
+		"t2: begin",
+		"t1: ascend-k0-k2",
+		"t2: set-k1-t2",
+		"t2: commit",
+		"t1: ascend-k0-k2",
+		"t1: commit",
+	},
+	ReadOnlyAnomaly: readOnlyTxAnomalySteps,
+}
+
+// IsolationReport describes the anomalies observed with a backend.
+type IsolationReport struct {
+	// Permitted holds the anomalies that were observed with the backend.
+	Permitted []Anomaly
+
+	// Details holds the description of the non-serializable outcome for each
+	// permitted anomaly.
+	Details map[Anomaly]string
+
+	// Level is the strongest isolation level consistent with the observed
+	// anomalies. Backends that permit dirty writes are reported as
+	// ReadUncommitted, which is the weakest level.
+	Level txtest.IsolationLevel
+}
+
+// Permits returns true if the anomaly was observed with the backend.
+func (r *IsolationReport) Permits(a Anomaly) bool {
+	_, ok := r.Details[a]
+	return ok
+}
+
+func (r *IsolationReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "isolation level: %s\n", r.Level)
+	for i := range anomalyNames {
+		a := Anomaly(i)
+		status := "prevented"
+		if r.Permits(a) {
+			status = "permitted"
+		}
+		fmt.Fprintf(&sb, "  %-20s %s\n", a, status)
+	}
+	return sb.String()
+}
+
+// ClassifyIsolation runs a test for every anomaly and reports the anomalies
+// permitted by the backend along with the strongest isolation level
+// consistent with them.
+func ClassifyIsolation(ctx context.Context, opts *Options) (*IsolationReport, error) {
+	r := &IsolationReport{
+		Details: make(map[Anomaly]string),
+	}
+	for i := range anomalyNames {
+		a := Anomaly(i)
+		permitted, err := checkAnomaly(ctx, opts, anomalySteps[a])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", a, err)
+		}
+		if len(permitted) > 0 {
+			r.Permitted = append(r.Permitted, a)
+			r.Details[a] = permitted
+		}
+	}
+
+	r.Level = txtest.Serializable
+	if r.Permits(WriteSkew) || r.Permits(ReadOnlyAnomaly) {
+		r.Level = txtest.SnapshotIsolation
+	}
+	if r.Permits(LostUpdate) || r.Permits(ReadSkew) || r.Permits(NonRepeatableRead) || r.Permits(Phantom) {
+		r.Level = txtest.ReadCommitted
+	}
+	if r.Permits(DirtyRead) || r.Permits(DirtyWrite) {
+		r.Level = txtest.ReadUncommitted
+	}
+	return r, nil
+}
+
+// checkAnomaly runs the steps and returns a non-empty description when the
+// outcome is not serializable.
+func checkAnomaly(ctx context.Context, opts *Options, steps []string) (string, error) {
+	it, err := runIsolationTestAt(ctx, opts, txtest.ReadUncommitted, steps)
+	if err != nil {
+		return "", err
+	}
+	if err := it.CheckSerializable(ctx, opts.NewTx, opts.NewIt); err != nil {
+		if errors.Is(err, txtest.ErrNotSerializable) {
+			return err.Error(), nil
+		}
+		return "", err
+	}
+	return "", nil
+}
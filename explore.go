@@ -0,0 +1,48 @@
+package kvtests
+
+import (
+	"context"
+
+	"github.com/bvkgo/kvtests/txtest"
+)
+
+// ExploreIsolationTest runs up to limit interleavings of the txes in the
+// steps, preserving the order of steps within each tx, and returns the
+// aggregated outcomes. Interleavings are randomly sampled using the
+// Options.Seed when there are more than the limit. Outcome of every
+// interleaving is checked for serializability when the level is Serializable.
+func ExploreIsolationTest(ctx context.Context, opts *Options, level txtest.IsolationLevel, steps []string, limit int) (*txtest.Exploration, error) {
+	opts.setDefaults()
+	if err := opts.Check(); err != nil {
+		return nil, err
+	}
+	if _, _, err := FillItems(ctx, opts); err != nil {
+		return nil, err
+	}
+	programs, err := txtest.Programs(steps)
+	if err != nil {
+		return nil, err
+	}
+	_, nkey, err := txtest.ParseSteps(steps)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := opts.selectKeys(nkey)
+	if err != nil {
+		return nil, err
+	}
+
+	eopts := &txtest.ExploreOptions{
+		MaxInterleavings: limit,
+		Seed:             opts.Seed,
+		Concurrent:       opts.Concurrent,
+		BlockWait:        opts.BlockWait,
+		Finals:           txtest.FinalSteps(steps),
+	}
+	if level >= txtest.Serializable {
+		eopts.Check = func(ctx context.Context, it *txtest.IsolationTest) error {
+			return it.CheckSerializable(ctx, opts.NewTx, opts.NewIt)
+		}
+	}
+	return txtest.Explore(ctx, opts.NewTx, opts.NewIt, keys, programs, eopts)
+}
@@ -2,48 +2,93 @@ package kvtests
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"os"
 	"testing"
 
+	"github.com/bvkgo/kv"
 	"github.com/bvkgo/kvtests/txtest"
 )
 
-func RunAllIsolationTests(t *testing.T, ctx context.Context, opts *Options) {
-	if err := SerializedTxes(ctx, opts); err != nil {
-		t.Errorf("SerializedTxes: %v", err)
-	}
-
-	if err := NonConflictingTxes(ctx, opts); err != nil {
-		t.Errorf("NonConflictingTxes: %v", err)
-	}
-
-	if err := ConflictingReadOnlyTxes(ctx, opts); err != nil {
-		t.Errorf("ConflictingReadOnlyTxes: %v", err)
-	}
+// isolationScenarios lists the scenarios run by RunAllIsolationTests. Field
+// concurrentWriters is true for the scenarios that drive more than one writer
+// tx directly, so they cannot run with backends that serialize the writers.
+var isolationScenarios = []struct {
+	name              string
+	run               func(context.Context, *Options) error
+	concurrentWriters bool
+}{
+	{name: "SerializedTxes", run: SerializedTxes},
+	{name: "ArbitraryValues", run: ArbitraryValues},
+	{name: "NonConflictingTxes", run: NonConflictingTxes},
+	{name: "ConflictingReadOnlyTxes", run: ConflictingReadOnlyTxes},
+	{name: "ConflictingReadWriteTxes", run: ConflictingReadWriteTxes},
+	{name: "BlockedReads", run: BlockedReads},
+	{name: "LostUpdates", run: LostUpdates},
+	{name: "DirtyWrites", run: DirtyWrites},
+	{name: "ConflictingDeletes", run: ConflictingDeletes},
+	{name: "NonConflictingDeletes", run: NonConflictingDeletes},
+	{name: "AbortedReads", run: AbortedReads},
+	{name: "RepeatedReads", run: RepeatedReads},
+	{name: "PhantomInserts", run: PhantomInserts},
+	{name: "PhantomDeletes", run: PhantomDeletes},
+	{name: "PredicateWriteSkew", run: PredicateWriteSkew, concurrentWriters: true},
+	{name: "SkewedWrites", run: func(ctx context.Context, opts *Options) error {
+		return SkewedWrites(ctx, opts, opts.isolation())
+	}},
+	{name: "ReadOnlyTxAnomaly", run: func(ctx context.Context, opts *Options) error {
+		return ReadOnlyTxAnomaly(ctx, opts, opts.isolation())
+	}},
+}
 
-	if err := ConflictingReadWriteTxes(ctx, opts); err != nil {
-		t.Errorf("ConflictingReadWriteTxes: %v", err)
+// RunAllIsolationTests runs all isolation scenarios that are supported by the
+// Options.Guarantees as subtests. Outcomes are checked only for the anomalies
+// that are prevented by the promised isolation level.
+func RunAllIsolationTests(t *testing.T, ctx context.Context, opts *Options) {
+	opts.setDefaults()
+	for _, s := range isolationScenarios {
+		if s.concurrentWriters && opts.serialWriters() {
+			continue
+		}
+		runSubtest(t, ctx, opts, s.name, opts.Parallel, s.run)
 	}
+}
 
-	if err := ConflictingDeletes(ctx, opts); err != nil {
-		t.Errorf("ConflictingDeletes: %v", err)
-	}
+// runScenario runs the steps as the named scenario using runIsolationTestAt.
+// Outcome is checked at the given level or at the level promised by the
+// backend, whichever is weaker. Returns the test and its result, along with
+// a ScenarioError if the run or a check fails.
+func runScenario(ctx context.Context, opts *Options, name string, level txtest.IsolationLevel, steps []string) (*txtest.IsolationTest, *ScenarioResult, error) {
+	return runScenarioKeys(ctx, opts, name, level, steps, nil)
+}
 
-	if err := NonConflictingDeletes(ctx, opts); err != nil {
-		t.Errorf("NonConflictingDeletes: %v", err)
+// runScenarioKeys is like runScenario, but runs the steps with the given
+// keys, if any, instead of randomly selected keys.
+func runScenarioKeys(ctx context.Context, opts *Options, name string, level txtest.IsolationLevel, steps, keys []string) (*txtest.IsolationTest, *ScenarioResult, error) {
+	if l := opts.isolation(); l < level {
+		level = l
 	}
-
-	if err := AbortedReads(ctx, opts); err != nil {
-		t.Errorf("AbortedReads: %v", err)
+	it, err := runIsolationTestKeys(ctx, opts, level, steps, keys)
+	r := newScenarioResult(name, opts, it)
+	opts.reportResult(r)
+	if err != nil {
+		return it, r, r.fail(err)
 	}
+	return it, r, nil
+}
 
-	if err := RepeatedReads(ctx, opts); err != nil {
-		t.Errorf("RepeatedReads: %v", err)
-	}
+// runIsolationTestAt runs the steps and checks the expected results in the
+// steps. Outcome is also checked for equivalence with a serial execution when
+// the level is Serializable. Test is returned along with the error when it
+// was created, so that the results of a failed run can be reported.
+func runIsolationTestAt(ctx context.Context, opts *Options, level txtest.IsolationLevel, steps []string) (*txtest.IsolationTest, error) {
+	return runIsolationTestKeys(ctx, opts, level, steps, nil)
 }
 
-func runIsolationTest(ctx context.Context, opts *Options, steps []string) (*txtest.IsolationTest, error) {
+// runIsolationTestKeys is like runIsolationTestAt, but runs the steps with
+// the given keys. Keys are selected randomly when nil.
+func runIsolationTestKeys(ctx context.Context, opts *Options, level txtest.IsolationLevel, steps, keys []string) (*txtest.IsolationTest, error) {
 	opts.setDefaults()
 	if err := opts.Check(); err != nil {
 		return nil, err
@@ -55,12 +100,25 @@ func runIsolationTest(ctx context.Context, opts *Options, steps []string) (*txte
 	if err != nil {
 		return nil, err
 	}
-	keys, err := opts.selectKeys(it.NumKey())
-	if err != nil {
-		return nil, err
+	if keys == nil {
+		if keys, err = opts.selectKeys(it.NumKey()); err != nil {
+			return nil, err
+		}
 	}
-	if _, err := it.Run(ctx, opts.NewTx, keys); err != nil {
-		return nil, fmt.Errorf("run tx steps failed: %w", err)
+	if opts.Concurrent || opts.serialWriters() || opts.blockingReads() {
+		it.SetConcurrent(opts.BlockWait)
+	}
+	it.SetStepTimeout(opts.StepTimeout)
+	if _, err := it.Run(ctx, opts.NewTx, opts.NewIt, keys); err != nil {
+		return it, fmt.Errorf("run tx steps failed: %w", err)
+	}
+	if err := it.CheckExpectations(); err != nil {
+		return it, err
+	}
+	if level >= txtest.Serializable {
+		if err := it.CheckSerializable(ctx, opts.NewTx, opts.NewIt); err != nil {
+			return it, err
+		}
 	}
 	return it, nil
 }
@@ -68,46 +126,65 @@ func runIsolationTest(ctx context.Context, opts *Options, steps []string) (*txte
 func SerializedTxes(ctx context.Context, opts *Options) error {
 	steps := []string{
 		"t0: begin",
-		"t0: get-k0",
+		"t0: get-k0 => initial",
 		"t0: set-k0-t0",
-		"t0: commit",
+		"t0: commit => ok",
 
 		"t1: begin",
-		"t1: get-k0",
+		"t1: get-k0 => t0",
 		"t1: set-k0-t1",
-		"t1: commit",
+		"t1: commit => ok",
 
 		"t2: begin",
-		"t2: get-k0",
+		"t2: get-k0 => t1",
 		"t2: set-k0-t2",
-		"t2: commit",
+		"t2: commit => ok",
 
 		"t3: begin",
 		"t3: delete-k0",
-		"t3: commit",
+		"t3: commit => ok",
 
 		"t4: begin",
-		"t4: get-k0",
-		"t4: commit",
+		"t4: get-k0 => os.ErrNotExist",
+		"t4: commit => ok",
+
+		"final: k0 = os.ErrNotExist",
 	}
-	it, err := runIsolationTest(ctx, opts, steps)
-	if err != nil {
+	if _, _, err := runScenario(ctx, opts, "SerializedTxes", txtest.Serializable, steps); err != nil {
 		return err
 	}
-	if n := it.NumSuccess(); n != 5 {
-		for i, result := range it.Results() {
-			log.Printf("tx%d -> %v", i, result)
-		}
-		return fmt.Errorf("all txes are expected to commit")
+	return nil
+}
+
+// ArbitraryValues checks that empty, binary, unicode and large values are
+// read back exactly as they were written, both by the writer tx and by a
+// later tx.
+func ArbitraryValues(ctx context.Context, opts *Options) error {
+	opts.setDefaults()
+	binary := make([]byte, 256)
+	for i := range binary {
+		binary[i] = byte(i)
 	}
-	if v := it.GetResultAtLine(5); v != "t0" {
-		return fmt.Errorf("unexpected get result %q at line 5", v)
+	large := (&ValueGenerator{Sizes: []int{1 << 20}}).value(opts.rand)
+
+	values := []string{"", string(binary), "h\u00e9llo, \u4e16\u754c | => \"", large}
+	steps := []string{"t0: begin"}
+	for i, v := range values {
+		q := txtest.QuoteValue(v)
+		steps = append(steps,
+			fmt.Sprintf("t0: set-k%d-%s", i, q),
+			fmt.Sprintf("t0: get-k%d => %s", i, q))
+	}
+	steps = append(steps, "t0: commit => ok", "t1: begin")
+	for i, v := range values {
+		steps = append(steps, fmt.Sprintf("t1: get-k%d => %s", i, txtest.QuoteValue(v)))
 	}
-	if v := it.GetResultAtLine(9); v != "t1" {
-		return fmt.Errorf("unexpected get result %q at line 9", v)
+	steps = append(steps, "t1: commit => ok")
+	for i, v := range values {
+		steps = append(steps, fmt.Sprintf("final: k%d = %s", i, txtest.QuoteValue(v)))
 	}
-	if v := it.GetResultAtLine(16); v != "os.ErrNotExist" {
-		return fmt.Errorf("unexpected get result %q at line 16", v)
+	if _, _, err := runScenario(ctx, opts, "ArbitraryValues", txtest.Serializable, steps); err != nil {
+		return err
 	}
 	return nil
 }
@@ -123,72 +200,194 @@ func NonConflictingTxes(ctx context.Context, opts *Options) error {
 		"t1: get-k1",
 		"t1: set-k1-t1",
 
-		"t0: commit",
+		"t0: commit => ok",
 
 		"t2: get-k2",
 		"t2: set-k2-t2",
 
+		"t1: commit => ok",
+		"t2: commit => ok",
+
+		"final: k0 = t0",
+		"final: k1 = t1",
+		"final: k2 = t2",
+	}
+	if _, _, err := runScenario(ctx, opts, "NonConflictingTxes", txtest.Serializable, steps); err != nil {
+		return err
+	}
+	return nil
+}
+
+func ConflictingReadOnlyTxes(ctx context.Context, opts *Options) error {
+	steps := []string{
+		"t0: begin",
+		"t1: begin",
+		"t2: begin",
+		"t0: get-k0 => initial",
+		"t1: get-k0 => initial",
+		"t0: commit => ok",
+		"t2: get-k0 => initial",
+		"t1: commit => ok",
+		"t2: commit => ok",
+	}
+	if _, _, err := runScenario(ctx, opts, "ConflictingReadOnlyTxes", txtest.Serializable, steps); err != nil {
+		return err
+	}
+	return nil
+}
+
+func ConflictingReadWriteTxes(ctx context.Context, opts *Options) error {
+	steps := []string{
+		"t0: begin",
+		"t1: begin",
+
+		"t0: set-k0-t0",
+		"t1: get-k0",
+
+		"t0: commit",
 		"t1: commit",
-		"t2: commit",
 	}
-	it, err := runIsolationTest(ctx, opts, steps)
+	it, r, err := runScenario(ctx, opts, "ConflictingReadWriteTxes", txtest.Serializable, steps)
 	if err != nil {
 		return err
 	}
-	if n := it.NumSuccess(); n != 3 {
-		for i, result := range it.Results() {
-			log.Printf("tx%d -> %v", i, result)
-		}
-		return fmt.Errorf("all txes are expected to commit")
+	if n := it.NumSuccess(); n < 1 {
+		return r.fail(fmt.Errorf("at least one tx is expected to commit"))
+	}
+	if err := checkCommittedWrite(it, 0, map[int]string{0: "t0"}); err != nil {
+		return r.fail(err)
 	}
 	return nil
 }
 
-func ConflictingReadOnlyTxes(ctx context.Context, opts *Options) error {
+// BlockedReads checks that a get on a key updated by an uncommitted tx
+// returns the new value only after the writer tx has committed. Backends with
+// lock-based concurrency control may block the get till the writer commits,
+// so the scenario is always run in the concurrent mode. Get must block when
+// the backend promises Guarantees.BlockingReads.
+func BlockedReads(ctx context.Context, opts *Options) error {
+	copts := *opts
+	copts.Concurrent = true
+	opts = &copts
+
 	steps := []string{
 		"t0: begin",
 		"t1: begin",
-		"t2: begin",
+
+		"t0: set-k0-t0",
+		"t1: get-k0 => initial|t0",
+
+		"t0: commit => ok",
+		"t1: commit",
+	}
+	it, r, err := runScenario(ctx, opts, "BlockedReads", txtest.Serializable, steps)
+	if err != nil {
+		return err
+	}
+	// Commit step is issued only after the get has completed or is blocked,
+	// so a get that is not blocked has completed before the commit.
+	get := it.StepResultAtLine(3)
+	if opts.blockingReads() && !get.Blocked {
+		return r.fail(fmt.Errorf("get did not block on the key written by an uncommitted tx"))
+	}
+	if get.Status != txtest.StepSucceeded || opts.isolation() < txtest.ReadCommitted {
+		// Failing the reader tx is a valid way to avoid the dirty read, which
+		// is permitted below read-committed anyway.
+		return nil
+	}
+	if v := it.GetResultAtLine(3); v == "t0" && !get.Blocked {
+		return r.fail(fmt.Errorf("noticed dirty read: get returned %q before the writer tx has committed", v))
+	}
+	return nil
+}
+
+// LostUpdates runs two txes that read and then update the same key. Both
+// txes cannot commit, because one of the updates would be lost. Final value
+// must be the update from the committed tx. Lost updates are permitted below
+// snapshot isolation.
+func LostUpdates(ctx context.Context, opts *Options) error {
+	steps := []string{
+		"t0: begin",
+		"t1: begin",
+
 		"t0: get-k0",
 		"t1: get-k0",
+
+		"t0: set-k0-t0",
+		"t1: set-k0-t1",
+
 		"t0: commit",
-		"t2: get-k0",
 		"t1: commit",
-		"t2: commit",
 	}
-	it, err := runIsolationTest(ctx, opts, steps)
+	it, r, err := runScenario(ctx, opts, "LostUpdates", txtest.ReadUncommitted, steps)
 	if err != nil {
 		return err
 	}
-	if n := it.NumSuccess(); n != 3 {
-		for i, result := range it.Results() {
-			log.Printf("tx%d -> %v", i, result)
-		}
-		return fmt.Errorf("all txes are expected to commit")
+	if err := checkCommittedWrite(it, 0, map[int]string{0: "t0", 1: "t1"}); err != nil {
+		return r.fail(err)
+	}
+	// Update is lost only when neither tx has read the other's update, which
+	// is possible with backends that block the reads.
+	if n := it.NumSuccess(); n > 1 && it.GetResultAtLine(2) == it.GetResultAtLine(3) && opts.isolation() >= txtest.SnapshotIsolation {
+		return r.fail(fmt.Errorf("noticed lost update: both txes committed, but final value of k0 is %q", it.Values()[0]))
 	}
 	return nil
 }
 
-func ConflictingReadWriteTxes(ctx context.Context, opts *Options) error {
+// DirtyWrites runs two txes that update the same two keys in the opposite
+// order. Both keys must have the values from the same committed tx.
+func DirtyWrites(ctx context.Context, opts *Options) error {
 	steps := []string{
 		"t0: begin",
 		"t1: begin",
 
 		"t0: set-k0-t0",
-		"t1: get-k0",
+		"t1: set-k0-t1",
+		"t1: set-k1-t1",
+		"t0: set-k1-t0",
 
 		"t0: commit",
 		"t1: commit",
 	}
-	it, err := runIsolationTest(ctx, opts, steps)
+	it, r, err := runScenario(ctx, opts, "DirtyWrites", txtest.ReadUncommitted, steps)
 	if err != nil {
 		return err
 	}
-	if n := it.NumSuccess(); n < 1 {
-		for i, result := range it.Results() {
-			log.Printf("tx%d -> %v", i, result)
+	writes := map[int]string{0: "t0", 1: "t1"}
+	if err := checkCommittedWrite(it, 0, writes); err != nil {
+		return r.fail(err)
+	}
+	if err := checkCommittedWrite(it, 1, writes); err != nil {
+		return r.fail(err)
+	}
+	if values := it.Values(); values[0] != values[1] {
+		return r.fail(fmt.Errorf("noticed dirty write: k0 has %q, but k1 has %q", values[0], values[1]))
+	}
+	return nil
+}
+
+// checkCommittedWrite verifies that the final value of the key with id kid
+// is the value written by one of the committed txes. Writes map holds the
+// value written to the key by each tx that updates it; all these txes are
+// expected to end with a commit.
+func checkCommittedWrite(it *txtest.IsolationTest, kid int, writes map[int]string) error {
+	final := it.Values()[kid]
+	results := it.Results()
+
+	ncommit := 0
+	for tx, v := range writes {
+		if results[tx] == nil {
+			if v == final {
+				return nil
+			}
+			ncommit++
 		}
-		return fmt.Errorf("at least one tx is expected to commit")
+	}
+	if ncommit > 0 {
+		return fmt.Errorf("committed write to k%d has vanished: final value is %q (results %v)", kid, final, results)
+	}
+	if initial := it.Keys()[kid]; final != initial {
+		return fmt.Errorf("k%d has value %q from an uncommitted tx (results %v)", kid, final, results)
 	}
 	return nil
 }
@@ -204,15 +403,12 @@ func ConflictingDeletes(ctx context.Context, opts *Options) error {
 		"t0: commit",
 		"t1: commit",
 	}
-	it, err := runIsolationTest(ctx, opts, steps)
+	it, r, err := runScenario(ctx, opts, "ConflictingDeletes", txtest.Serializable, steps)
 	if err != nil {
 		return err
 	}
 	if n := it.NumSuccess(); n < 1 {
-		for i, result := range it.Results() {
-			log.Printf("tx%d -> %v", i, result)
-		}
-		return fmt.Errorf("at least one tx is expected to commit")
+		return r.fail(fmt.Errorf("at least one tx is expected to commit"))
 	}
 	return nil
 }
@@ -225,19 +421,15 @@ func NonConflictingDeletes(ctx context.Context, opts *Options) error {
 		"t0: delete-k0",
 		"t1: delete-k1",
 
-		"t0: commit",
-		"t1: commit",
+		"t0: commit => ok",
+		"t1: commit => ok",
+
+		"final: k0 = os.ErrNotExist",
+		"final: k1 = os.ErrNotExist",
 	}
-	it, err := runIsolationTest(ctx, opts, steps)
-	if err != nil {
+	if _, _, err := runScenario(ctx, opts, "NonConflictingDeletes", txtest.Serializable, steps); err != nil {
 		return err
 	}
-	if n := it.NumSuccess(); n != 2 {
-		for i, result := range it.Results() {
-			log.Printf("tx%d -> %v", i, result)
-		}
-		return fmt.Errorf("all txes are expected to commit")
-	}
 	return nil
 }
 
@@ -250,16 +442,19 @@ func AbortedReads(ctx context.Context, opts *Options) error {
 		"t0: abort",
 		"t1: commit",
 	}
-	it, err := runIsolationTest(ctx, opts, steps)
+	it, r, err := runScenario(ctx, opts, "AbortedReads", txtest.Serializable, steps)
 	if err != nil {
 		return err
 	}
 	if n := it.NumSuccess(); n < 1 {
-		return fmt.Errorf("one tx is expected to commit")
+		return r.fail(fmt.Errorf("one tx is expected to commit"))
 	}
 	return nil
 }
 
+// RepeatedReads checks that a tx reads the same value for a key twice, even
+// though a concurrent tx updates the key in between. Non-repeatable reads are
+// permitted below snapshot isolation.
 func RepeatedReads(ctx context.Context, opts *Options) error {
 	steps := []string{
 		"t0: begin",
@@ -270,17 +465,248 @@ func RepeatedReads(ctx context.Context, opts *Options) error {
 		"t1: get-k0",
 		"t1: commit",
 	}
-	it, err := runIsolationTest(ctx, opts, steps)
+	it, r, err := runScenario(ctx, opts, "RepeatedReads", txtest.Serializable, steps)
 	if err != nil {
 		return err
 	}
 	if n := it.NumSuccess(); n < 1 {
-		return fmt.Errorf("at least one tx is expected to commit")
+		return r.fail(fmt.Errorf("at least one tx is expected to commit"))
 	}
 	t1get0 := it.GetResultAtLine(2)
 	t1get1 := it.GetResultAtLine(5)
-	if t1get0 != t1get1 {
-		return fmt.Errorf("noticed read-committed")
+	if t1get0 != t1get1 && opts.isolation() >= txtest.SnapshotIsolation {
+		return r.fail(fmt.Errorf("noticed read-committed"))
+	}
+	return nil
+}
+
+// SkewedWrites runs two txes that read the same two keys and each update a
+// different key. Snapshot isolation permits both txes to commit, which is the
+// write-skew anomaly, so the outcome is required to be serializable only when
+// the level is Serializable.
+func SkewedWrites(ctx context.Context, opts *Options, level txtest.IsolationLevel) error {
+	it, err := runIsolationTestAt(ctx, opts, level, skewedWritesSteps)
+	r := newScenarioResult("SkewedWrites", opts, it)
+	opts.reportResult(r)
+	if err != nil {
+		if errors.Is(err, txtest.ErrNotSerializable) {
+			err = fmt.Errorf("noticed write skew: %w", err)
+		}
+		return r.fail(err)
+	}
+	return nil
+}
+
+// skewedWritesSteps holds the steps for SkewedWrites, which are also used by
+// ClassifyIsolation for the write-skew anomaly.
+var skewedWritesSteps = []string{
+	"t0: begin",
+	"t1: begin",
+
+	"t0: get-k0 => initial",
+	"t0: get-k1 => initial",
+	"t1: get-k0 => initial",
+	"t1: get-k1 => initial",
+
+	"t0: set-k0-t0",
+	"t1: set-k1-t1",
+
+	"t0: commit => ok|conflict",
+	"t1: commit => ok|conflict",
+
+	"final: k0 = t0|initial",
+	"final: k1 = t1|initial",
+}
+
+// ReadOnlyTxAnomaly runs the read-only tx anomaly from Fekete et al., "A
+// Read-Only Transaction Anomaly Under Snapshot Isolation". Tx t0 reads both
+// keys and updates k0, t1 updates k1 and commits, then the read-only t2
+// observes t1's update, but not t0's. Committing all three txes is permitted
+// by snapshot isolation, but is not serializable, so the outcome is required
+// to be serializable only when the level is Serializable.
+func ReadOnlyTxAnomaly(ctx context.Context, opts *Options, level txtest.IsolationLevel) error {
+	it, err := runIsolationTestAt(ctx, opts, level, readOnlyTxAnomalySteps)
+	r := newScenarioResult("ReadOnlyTxAnomaly", opts, it)
+	opts.reportResult(r)
+	if err != nil {
+		if errors.Is(err, txtest.ErrNotSerializable) {
+			err = fmt.Errorf("noticed read-only tx anomaly: %w", err)
+		}
+		return r.fail(err)
 	}
 	return nil
 }
+
+// readOnlyTxAnomalySteps holds the steps for ReadOnlyTxAnomaly, which are also
+// used by ClassifyIsolation for the read-only anomaly.
+var readOnlyTxAnomalySteps = []string{
+	"t0: begin",
+	"t0: get-k0 => initial",
+	"t0: get-k1 => initial",
+
+	"t1: begin",
+	"t1: get-k1 => initial",
+	"t1: set-k1-t1",
+	"t1: commit => ok",
+
+	"t2: begin",
+	"t2: get-k0 => initial",
+	"t2: get-k1 => t1",
+	"t2: commit => ok",
+
+	"t0: set-k0-t0",
+	"t0: commit => ok|conflict",
+
+	"final: k0 = t0|initial",
+	"final: k1 = t1",
+}
+
+// PhantomInserts checks that a key inserted into a range by a concurrent tx
+// does not appear when a committed tx rescans the same range. Phantoms are
+// permitted below snapshot isolation.
+func PhantomInserts(ctx context.Context, opts *Options) (status error) {
+	opts.setDefaults()
+	b, e, err := opts.selectRange(10)
+	if err != nil {
+		return err
+	}
+	// New key falls between two existing keys, so it is inside the range, but
+	// doesn't exist in the database when the range is scanned first.
+	phantom := opts.getKey((b+e)/2) + "-phantom"
+	defer func() {
+		if err := deleteKeys(ctx, opts, phantom); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	keys := []string{opts.getKey(b), phantom, opts.getKey(e)}
+	return runPhantomTest(ctx, opts, "PhantomInserts", keys, true, "t2: set-k1-t2")
+}
+
+// PhantomDeletes checks that a key deleted from a range by a concurrent tx
+// does not disappear when a committed tx rescans the same range. Phantoms are
+// permitted below snapshot isolation.
+func PhantomDeletes(ctx context.Context, opts *Options) error {
+	opts.setDefaults()
+	b, e, err := opts.selectRange(10)
+	if err != nil {
+		return err
+	}
+	keys := []string{opts.getKey(b), opts.getKey((b + e) / 2), opts.getKey(e)}
+	return runPhantomTest(ctx, opts, "PhantomDeletes", keys, false, "t2: delete-k1")
+}
+
+// PredicateWriteSkew checks that two txes, each of which scans the same range
+// and then inserts a new key into it, cannot both commit. Committing both is
+// not equivalent to any serial order, because a serial execution would make
+// one of the inserts visible to the other tx's scan. Snapshot isolation
+// permits this anomaly, so it is checked only for serializable backends.
+func PredicateWriteSkew(ctx context.Context, opts *Options) (status error) {
+	opts.setDefaults()
+	b, e, err := opts.selectRange(10)
+	if err != nil {
+		return err
+	}
+	keys := []string{
+		opts.getKey(b),
+		opts.getKey(b) + "-phantom",
+		opts.getKey(e-1) + "-phantom",
+		opts.getKey(e),
+	}
+	defer func() {
+		if err := deleteKeys(ctx, opts, keys[1], keys[2]); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	steps := []string{
+		// New keys are removed, so they don't exist when the range is scanned.
+		"t0: begin",
+		"t0: delete-k1",
+		"t0: delete-k2",
+		"t0: commit => ok",
+
+		"t1: begin",
+		"t2: begin",
+		"t1: ascend-k0-k3",
+		"t2: ascend-k0-k3",
+		"t1: set-k1-t1",
+		"t2: set-k2-t2",
+		"t1: commit",
+		"t2: commit",
+	}
+	// Committing both txes is caught by the serializability check.
+	_, _, err = runScenarioKeys(ctx, opts, "PredicateWriteSkew", txtest.Serializable, steps, keys)
+	return err
+}
+
+// runPhantomTest runs a tx that scans the range [k0, k2) of the keys twice,
+// while another tx runs the modify step on k1 and commits in between. Both
+// scans must return the same keys at snapshot isolation and above, unless
+// the scanning tx fails to commit. Key k1 is deleted before the scans when
+// absent is true; otherwise k0 is updated, so that the lines do not change.
+func runPhantomTest(ctx context.Context, opts *Options, name string, keys []string, absent bool, modify string) error {
+	steps := []string{
+		"t0: begin",
+		"t0: set-k0-t0",
+		"t0: commit => ok",
+
+		"t1: begin",
+		"t1: ascend-k0-k2",
+
+		"t2: begin",
+		modify,
+		"t2: commit => ok",
+
+		"t1: ascend-k0-k2",
+		"t1: commit",
+	}
+	if absent {
+		steps[1] = "t0: delete-k1"
+	}
+	it, r, err := runScenarioKeys(ctx, opts, name, txtest.Serializable, steps, keys)
+	if err != nil {
+		return err
+	}
+	if !it.Committed()[1] {
+		// Aborting the tx is a valid way to prevent the phantom.
+		return nil
+	}
+	first, second := scanKeys(it.ScanResultAtLine(4)), scanKeys(it.ScanResultAtLine(8))
+	if !equalStrings(first, second) && opts.isolation() >= txtest.SnapshotIsolation {
+		return r.fail(fmt.Errorf("noticed phantom: range [k0, k2) had keys %v, then %v", first, second))
+	}
+	return nil
+}
+
+// scanKeys returns the keys in the scan result.
+func scanKeys(kvs []txtest.KeyValue) []string {
+	keys := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
+
+// ascendKeys returns the keys in the range [begin, end) as observed by the tx.
+func ascendKeys(ctx context.Context, opts *Options, tx kv.Transaction, begin, end string) ([]string, error) {
+	it, err := opts.NewIt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Ascend(ctx, begin, end, it); err != nil {
+		return nil, err
+	}
+	var keys []string
+	for {
+		k, _, err := it.GetNext(ctx)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
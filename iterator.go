@@ -5,12 +5,39 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"testing"
 
 	"github.com/bvkgo/kv"
 )
 
+// RunAllIteratorTests runs all iterator tests as subtests. Iterator tests
+// expect no other keys with the Options.Prefix than the keys created by
+// FillItems.
+func RunAllIteratorTests(t *testing.T, ctx context.Context, opts *Options) {
+	opts.setDefaults()
+	runSubtest(t, ctx, opts, "AscendTest1", opts.Parallel, RunAscendTest1)
+	runSubtest(t, ctx, opts, "DescendTest1", opts.Parallel, RunDescendTest1)
+	runSubtest(t, ctx, opts, "IteratorModelTest", opts.Parallel, RunIteratorModelTest)
+	runSubtest(t, ctx, opts, "KeyOrderTest", opts.Parallel, RunKeyOrderTest)
+	runSubtest(t, ctx, opts, "BoundaryTest", opts.Parallel, RunBoundaryTest)
+	runSubtest(t, ctx, opts, "IteratorLifecycleTest", opts.Parallel, RunIteratorLifecycleTest)
+	runSubtestT(t, ctx, opts, "IteratorSnapshotTest", opts.Parallel, func(t *testing.T, ctx context.Context, opts *Options) error {
+		r, err := RunIteratorSnapshotTest(ctx, opts)
+		if r != nil && err == nil {
+			// Report is a part of the error on violations.
+			t.Logf("iterator behavior:\n%s", r)
+		}
+		return err
+	})
+}
+
 type IteratorData struct {
+	// index returns the index of a key. Keys are parsed as integers when nil.
+	index func(string) (int, error)
+
 	count int
 
 	f, l int
@@ -18,15 +45,26 @@ type IteratorData struct {
 	first, last string
 }
 
+func (id *IteratorData) keyIndex(k string) (int, error) {
+	if id.index != nil {
+		return id.index(k)
+	}
+	v, err := strconv.Atoi(k)
+	if err != nil {
+		return -1, fmt.Errorf("could not parse key to int: %w", err)
+	}
+	return v, nil
+}
+
 func (id *IteratorData) HandleAscend(ctx context.Context, it kv.Iterator) error {
 	var err error
 	for k, _, err := it.GetNext(ctx); err == nil; k, _, err = it.GetNext(ctx) {
 		if len(k) == 0 {
 			return fmt.Errorf("key cannot be empty")
 		}
-		v, err := strconv.Atoi(k)
+		v, err := id.keyIndex(k)
 		if err != nil {
-			return fmt.Errorf("could not parse key to int: %w", err)
+			return err
 		}
 		if id.count > 0 {
 			if v < id.l {
@@ -57,9 +95,9 @@ func (id *IteratorData) HandleDescend(ctx context.Context, it kv.Iterator) error
 		if len(k) == 0 {
 			return fmt.Errorf("key cannot be empty")
 		}
-		v, err := strconv.Atoi(k)
+		v, err := id.keyIndex(k)
 		if err != nil {
-			return fmt.Errorf("could not parse key to int: %w", err)
+			return err
 		}
 		if id.count > 0 {
 			if v > id.l {
@@ -84,6 +122,158 @@ func (id *IteratorData) HandleDescend(ctx context.Context, it kv.Iterator) error
 	return nil
 }
 
+// IteratorValidator checks the key-value pairs returned by Ascend and Descend
+// iterators for arbitrary keys, which are compared as byte strings.
+type IteratorValidator struct {
+	// Keys holds all keys with the Prefix in the database, in any order.
+	Keys []string
+
+	// Values holds the expected values of the keys, if not nil.
+	Values map[string]string
+
+	// Prefix selects the keys that are checked for completeness. Other keys
+	// are checked only for their order and range, so that the database can
+	// have other data.
+	Prefix string
+}
+
+// ValidateAscend reads all key-value pairs from an iterator returned by
+// Ascend(i, j) and checks that keys are in strictly increasing byte order,
+// that every key is in the range, which includes min(i,j) and excludes
+// max(i,j), and that every key in the range is returned.
+func (v *IteratorValidator) ValidateAscend(ctx context.Context, it kv.Iterator, i, j string) error {
+	return v.validate(ctx, it, "ascend", i, j)
+}
+
+// ValidateDescend is similar to ValidateAscend, but for the iterators returned
+// by Descend(i, j), whose keys are in strictly decreasing byte order and whose
+// range includes max(i,j) and excludes min(i,j).
+func (v *IteratorValidator) ValidateDescend(ctx context.Context, it kv.Iterator, i, j string) error {
+	return v.validate(ctx, it, "descend", i, j)
+}
+
+func (v *IteratorValidator) validate(ctx context.Context, it kv.Iterator, name, i, j string) error {
+	ascend := name == "ascend"
+	inRange := inAscendRange
+	if !ascend {
+		inRange = inDescendRange
+	}
+
+	known := make(map[string]bool, len(v.Keys))
+	var want []string
+	for _, k := range v.Keys {
+		known[k] = true
+		if strings.HasPrefix(k, v.Prefix) && inRange(k, i, j) {
+			want = append(want, k)
+		}
+	}
+	if ascend {
+		sort.Strings(want)
+	} else {
+		sort.Sort(sort.Reverse(sort.StringSlice(want)))
+	}
+
+	var got []string
+	var last string
+	for n := 0; ; n++ {
+		k, value, err := it.GetNext(ctx)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s(%q, %q) failed after %d keys: %w", name, i, j, n, err)
+		}
+		if n > 0 && ((ascend && k <= last) || (!ascend && k >= last)) {
+			return fmt.Errorf("%s(%q, %q) returned %q after %q, which is out of order", name, i, j, k, last)
+		}
+		last = k
+		if !inRange(k, i, j) {
+			return fmt.Errorf("%s(%q, %q) returned %q, which is %s", name, i, j, k, outsideRange(k, i, j, ascend))
+		}
+		if !strings.HasPrefix(k, v.Prefix) {
+			continue
+		}
+		if !known[k] {
+			return fmt.Errorf("%s(%q, %q) returned %q, which is not in the database", name, i, j, k)
+		}
+		if want, ok := v.Values[k]; ok && value != want {
+			return fmt.Errorf("%s(%q, %q) returned key %q with a wrong value: %s", name, i, j, k, diffValues(value, want))
+		}
+		got = append(got, k)
+	}
+
+	// First expected key is the included bound when it exists.
+	if len(want) > 0 && (want[0] == i || want[0] == j) && (len(got) == 0 || got[0] != want[0]) {
+		return fmt.Errorf("%s(%q, %q) did not return the included bound %q", name, i, j, want[0])
+	}
+	if !equalStrings(got, want) {
+		return fmt.Errorf("%s(%q, %q) returned %s", name, i, j, describeKeysDiff(got, want))
+	}
+	return nil
+}
+
+// inAscendRange returns true if the key is in the range of Ascend(i, j),
+// which is [min(i,j), max(i,j)) when both bounds are non-empty, all keys from
+// the non-empty bound when one is empty and all keys when both are empty.
+func inAscendRange(k, i, j string) bool {
+	if i > j {
+		i, j = j, i
+	}
+	switch {
+	case i == "" && j == "":
+		return true
+	case i == "":
+		return k >= j
+	}
+	return k >= i && k < j
+}
+
+// inDescendRange returns true if the key is in the range of Descend(i, j),
+// which is (min(i,j), max(i,j)] when both bounds are non-empty, all keys till
+// the non-empty bound when one is empty and all keys when both are empty.
+func inDescendRange(k, i, j string) bool {
+	if i > j {
+		i, j = j, i
+	}
+	switch {
+	case i == "" && j == "":
+		return true
+	case i == "":
+		return k <= j
+	}
+	return k > i && k <= j
+}
+
+// outsideRange describes the position of a key that is not in the range.
+func outsideRange(k, i, j string, ascend bool) string {
+	if i > j {
+		i, j = j, i
+	}
+	if ascend && k == j {
+		return "the excluded upper bound"
+	}
+	if !ascend && k == i {
+		return "the excluded lower bound"
+	}
+	return "outside the range"
+}
+
+// describeKeysDiff describes the first difference between two key lists.
+func describeKeysDiff(got, want []string) string {
+	for n := 0; n < len(got) && n < len(want); n++ {
+		if got[n] != want[n] {
+			return fmt.Sprintf("%q at position %d instead of %q (%d keys, want %d)", got[n], n, want[n], len(got), len(want))
+		}
+	}
+	if len(got) > len(want) {
+		return fmt.Sprintf("unexpected %q at position %d (%d keys, want %d)", got[len(want)], len(want), len(got), len(want))
+	}
+	if len(got) < len(want) {
+		return fmt.Sprintf("no key at position %d instead of %q (%d keys, want %d)", len(got), want[len(got)], len(got), len(want))
+	}
+	return "the same keys"
+}
+
 func RunAscendTest1(ctx context.Context, opts *Options) error {
 	opts.setDefaults()
 	if err := opts.Check(); err != nil {
@@ -99,6 +289,7 @@ func RunAscendTest1(ctx context.Context, opts *Options) error {
 	if err != nil {
 		return err
 	}
+	begin, end := opts.ascendRange()
 
 	// Iterate all keys in ascending order.
 	{
@@ -110,10 +301,10 @@ func RunAscendTest1(ctx context.Context, opts *Options) error {
 		if err != nil {
 			return err
 		}
-		if err := tx.Ascend(ctx, "", "", it); err != nil {
+		if err := tx.Ascend(ctx, begin, end, it); err != nil {
 			return err
 		}
-		var id IteratorData
+		id := IteratorData{index: opts.keyIndex}
 		if err := id.HandleAscend(ctx, it); err != nil {
 			return err
 		}
@@ -125,7 +316,8 @@ func RunAscendTest1(ctx context.Context, opts *Options) error {
 		}
 	}
 
-	// Iterate till the largest key with one of i or j as the empty string.
+	// Iterate till the largest key with one of i or j as the end of the key
+	// range, which is the empty string when there is no prefix.
 	{
 		r := opts.rand.Intn(nkeys)
 		x := opts.getKey(r)
@@ -138,10 +330,10 @@ func RunAscendTest1(ctx context.Context, opts *Options) error {
 		if err != nil {
 			return err
 		}
-		if err := tx.Ascend(ctx, x, "", it); err != nil {
+		if err := tx.Ascend(ctx, x, end, it); err != nil {
 			return err
 		}
-		var id IteratorData
+		id := IteratorData{index: opts.keyIndex}
 		if err := id.HandleAscend(ctx, it); err != nil {
 			return err
 		}
@@ -170,10 +362,10 @@ func RunAscendTest1(ctx context.Context, opts *Options) error {
 		if err != nil {
 			return err
 		}
-		if err := tx.Ascend(ctx, "", x, it); err != nil {
+		if err := tx.Ascend(ctx, end, x, it); err != nil {
 			return err
 		}
-		var id IteratorData
+		id := IteratorData{index: opts.keyIndex}
 		if err := id.HandleAscend(ctx, it); err != nil {
 			return err
 		}
@@ -213,7 +405,7 @@ func RunAscendTest1(ctx context.Context, opts *Options) error {
 		if err := tx.Ascend(ctx, x, y, it); err != nil {
 			return err
 		}
-		var id IteratorData
+		id := IteratorData{index: opts.keyIndex}
 		if err := id.HandleAscend(ctx, it); err != nil {
 			return err
 		}
@@ -251,6 +443,7 @@ func RunDescendTest1(ctx context.Context, opts *Options) error {
 	if err != nil {
 		return err
 	}
+	begin, end := opts.descendRange()
 
 	// Iterate all keys in ascending order.
 	{
@@ -263,10 +456,10 @@ func RunDescendTest1(ctx context.Context, opts *Options) error {
 		if err != nil {
 			return err
 		}
-		if err := tx.Descend(ctx, "", "", it); err != nil {
+		if err := tx.Descend(ctx, begin, end, it); err != nil {
 			return err
 		}
-		var id IteratorData
+		id := IteratorData{index: opts.keyIndex}
 		if err := id.HandleDescend(ctx, it); err != nil {
 			return err
 		}
@@ -284,7 +477,8 @@ func RunDescendTest1(ctx context.Context, opts *Options) error {
 		}
 	}
 
-	// Iterate till the smallest key with one of i or j as the empty string.
+	// Iterate till the smallest key with one of i or j as the beginning of the
+	// key range, which is the empty string when there is no prefix.
 	{
 		r := opts.rand.Intn(nkeys)
 		x := opts.getKey(r)
@@ -297,10 +491,10 @@ func RunDescendTest1(ctx context.Context, opts *Options) error {
 		if err != nil {
 			return err
 		}
-		if err := tx.Descend(ctx, x, "", it); err != nil {
+		if err := tx.Descend(ctx, x, begin, it); err != nil {
 			return err
 		}
-		var id IteratorData
+		id := IteratorData{index: opts.keyIndex}
 		if err := id.HandleDescend(ctx, it); err != nil {
 			return err
 		}
@@ -329,10 +523,10 @@ func RunDescendTest1(ctx context.Context, opts *Options) error {
 		if err != nil {
 			return err
 		}
-		if err := tx.Descend(ctx, "", x, it); err != nil {
+		if err := tx.Descend(ctx, begin, x, it); err != nil {
 			return err
 		}
-		var id IteratorData
+		id := IteratorData{index: opts.keyIndex}
 		if err := id.HandleDescend(ctx, it); err != nil {
 			return err
 		}
@@ -372,7 +566,7 @@ func RunDescendTest1(ctx context.Context, opts *Options) error {
 		if err := tx.Descend(ctx, x, y, it); err != nil {
 			return err
 		}
-		var id IteratorData
+		id := IteratorData{index: opts.keyIndex}
 		if err := id.HandleDescend(ctx, it); err != nil {
 			return err
 		}
@@ -394,3 +588,96 @@ func RunDescendTest1(ctx context.Context, opts *Options) error {
 
 	return nil
 }
+
+// orderTestKeys are added to the database by RunKeyOrderTest. They share
+// prefixes with each other, have bytes that are not valid UTF-8 and multi-byte
+// unicode characters.
+var orderTestKeys = []string{
+	"\x00", "\x00\x00", "\x01", "\x7f", "\x80", "\xff", "\xff\xff",
+	"A", "Z", "a", "a\x00", "a\x00b", "aa", "aaa", "ab", "b",
+	"e\u0301", "\u00e9", "\u65e5\u672c", "\u65e5\u672c\u8a9e", "\U0001f600",
+}
+
+// RunKeyOrderTest adds keys with binary bytes, unicode characters and shared
+// prefixes under the "keyorder/" prefix in the Options.Prefix, and checks
+// Ascend and Descend for every pair of bounds from the added keys, the keys
+// right after them and the empty string. Other keys are checked only for
+// their order.
+func RunKeyOrderTest(ctx context.Context, opts *Options) (status error) {
+	opts.setDefaults()
+	if err := opts.Check(); err != nil {
+		return err
+	}
+
+	prefix := opts.Prefix + "keyorder/"
+	v := &IteratorValidator{Values: make(map[string]string), Prefix: prefix}
+	var added []string
+	for _, k := range orderTestKeys {
+		added = append(added, prefix+k)
+	}
+	defer func() {
+		if err := deleteKeys(ctx, opts, added...); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range added {
+		v.Values[k] = "value of " + k
+		if err := tx.Set(ctx, k, v.Values[k]); err != nil {
+			_ = tx.Discard(ctx)
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("could not add the keys: %w", err)
+	}
+	for k := range v.Values {
+		v.Keys = append(v.Keys, k)
+	}
+
+	bounds := []string{""}
+	for _, k := range added {
+		bounds = append(bounds, k, k+"\x00")
+	}
+	check := func(i, j string) (status error) {
+		tx, err := opts.NewTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := tx.Discard(ctx); err != nil && status == nil {
+				status = err
+			}
+		}()
+
+		it, err := opts.NewIt(ctx)
+		if err != nil {
+			return err
+		}
+		if err := tx.Ascend(ctx, i, j, it); err != nil {
+			return fmt.Errorf("ascend(%q, %q) failed: %w", i, j, err)
+		}
+		if err := v.ValidateAscend(ctx, it, i, j); err != nil {
+			return err
+		}
+		if it, err = opts.NewIt(ctx); err != nil {
+			return err
+		}
+		if err := tx.Descend(ctx, i, j, it); err != nil {
+			return fmt.Errorf("descend(%q, %q) failed: %w", i, j, err)
+		}
+		return v.ValidateDescend(ctx, it, i, j)
+	}
+	for _, i := range bounds {
+		for _, j := range bounds {
+			if err := check(i, j); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
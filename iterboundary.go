@@ -0,0 +1,182 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bvkgo/kv"
+)
+
+// boundaryCase holds the expected keys from Ascend(i, j) and Descend(i, j).
+// Keys and non-empty bounds are relative to the namespace of the test.
+type boundaryCase struct {
+	i, j            string
+	ascend, descend []string
+}
+
+// boundaryKeySets lists the keys in the namespace and the expected results for
+// the boundary ranges checked by RunBoundaryTest. Ascend includes min(i,j)
+// and excludes max(i,j); Descend includes max(i,j) and excludes min(i,j).
+// When a bound is empty, Ascend runs from the other bound to the largest key
+// and Descend runs from the other bound to the smallest key.
+var boundaryKeySets = []struct {
+	name  string
+	keys  []string
+	cases []boundaryCase
+}{
+	{
+		name: "EmptyStore",
+		cases: []boundaryCase{
+			{i: "", j: ""},
+			{i: "a", j: ""},
+			{i: "", j: "a"},
+			{i: "a", j: "a"},
+			{i: "a", j: "z"},
+			{i: "z", j: "a"},
+		},
+	},
+	{
+		name: "SingleKey",
+		keys: []string{"m"},
+		cases: []boundaryCase{
+			{i: "", j: "", ascend: []string{"m"}, descend: []string{"m"}},
+			{i: "m", j: "m"},
+			{i: "a", j: "z", ascend: []string{"m"}, descend: []string{"m"}},
+			{i: "z", j: "a", ascend: []string{"m"}, descend: []string{"m"}},
+			{i: "m", j: "z", ascend: []string{"m"}},
+			{i: "a", j: "m", descend: []string{"m"}},
+			{i: "m", j: "", ascend: []string{"m"}, descend: []string{"m"}},
+			{i: "", j: "m", ascend: []string{"m"}, descend: []string{"m"}},
+			{i: "a", j: "", ascend: []string{"m"}},
+			{i: "z", j: "", descend: []string{"m"}},
+			{i: "a", j: "b"},
+			{i: "n", j: "z"},
+		},
+	},
+	{
+		name: "ThreeKeys",
+		keys: []string{"b", "d", "f"},
+		cases: []boundaryCase{
+			{i: "", j: "", ascend: []string{"b", "d", "f"}, descend: []string{"f", "d", "b"}},
+			{i: "b", j: "f", ascend: []string{"b", "d"}, descend: []string{"f", "d"}},
+			{i: "f", j: "b", ascend: []string{"b", "d"}, descend: []string{"f", "d"}},
+			{i: "c", j: "e", ascend: []string{"d"}, descend: []string{"d"}},
+			{i: "d", j: "d"},
+			{i: "a", j: "b", descend: []string{"b"}},
+			{i: "f", j: "z", ascend: []string{"f"}},
+			{i: "a", j: "z", ascend: []string{"b", "d", "f"}, descend: []string{"f", "d", "b"}},
+			{i: "g", j: "z"},
+			{i: "a", j: "a"},
+			{i: "d", j: "", ascend: []string{"d", "f"}, descend: []string{"d", "b"}},
+		},
+	},
+}
+
+// RunBoundaryTest checks Ascend and Descend for an empty store, a single key
+// and three keys with empty ranges, reversed bounds, bounds on and between
+// the keys and ranges outside of the keys. Keys are created under the
+// "boundary/" prefix in the Options.Prefix and other keys are ignored, so an
+// empty store is an empty namespace.
+func RunBoundaryTest(ctx context.Context, opts *Options) (status error) {
+	opts.setDefaults()
+	if err := opts.Check(); err != nil {
+		return err
+	}
+
+	prefix := opts.Prefix + "boundary/"
+	var keys []string
+	defer func() {
+		if err := deleteKeys(ctx, opts, keys...); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	for _, set := range boundaryKeySets {
+		if err := deleteKeys(ctx, opts, keys...); err != nil {
+			return err
+		}
+		keys = keys[:0]
+		for _, k := range set.keys {
+			keys = append(keys, prefix+k)
+		}
+		if err := updateKeys(ctx, opts, func(ctx context.Context, tx kv.Transaction) error {
+			for _, k := range keys {
+				if err := tx.Set(ctx, k, k); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("%s: could not create the keys: %w", set.name, err)
+		}
+
+		for _, c := range set.cases {
+			i, j := c.i, c.j
+			if i != "" {
+				i = prefix + i
+			}
+			if j != "" {
+				j = prefix + j
+			}
+			for _, ascend := range []bool{true, false} {
+				name, want := "ascend", c.ascend
+				if !ascend {
+					name, want = "descend", c.descend
+				}
+				var got []string
+				if err := runRecovered(func() (err error) {
+					got, err = boundaryKeys(ctx, opts, prefix, ascend, i, j)
+					return err
+				}); err != nil {
+					return fmt.Errorf("%s: %s(%q, %q) failed: %w", set.name, name, c.i, c.j, err)
+				}
+				if !equalStrings(got, want) {
+					return fmt.Errorf("%s: %s(%q, %q) returned %s", set.name, name, c.i, c.j, describeKeysDiff(got, want))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// boundaryKeys returns the keys with the prefix, without the prefix, from
+// Ascend or Descend in a new tx.
+func boundaryKeys(ctx context.Context, opts *Options, prefix string, ascend bool, i, j string) (keys []string, status error) {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := tx.Discard(ctx); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	it, err := opts.NewIt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ascend {
+		err = tx.Ascend(ctx, i, j, it)
+	} else {
+		err = tx.Descend(ctx, i, j, it)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for {
+		k, _, err := it.GetNext(ctx)
+		if errors.Is(err, os.ErrNotExist) {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, strings.TrimPrefix(k, prefix))
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/bvkgo/kv"
+)
+
+// goroutineWait is the duration to wait for the goroutines started by a case
+// to exit before they are reported as leaked.
+const goroutineWait = time.Second
+
+// iteratorLifecycleCases lists the cases checked by RunIteratorLifecycleTest.
+// Every case iterates over the range [begin, end) of the keys created by
+// FillItems, which are all in the validator.
+var iteratorLifecycleCases = []struct {
+	name string
+	run  func(ctx context.Context, opts *Options, v *IteratorValidator, begin, end string) error
+}{
+	{name: "EarlyTermination", run: earlyTermination},
+	{name: "DiscardWithOpenIterator", run: func(ctx context.Context, opts *Options, v *IteratorValidator, begin, end string) error {
+		return endWithOpenIterator(ctx, opts, v, begin, end, false)
+	}},
+	{name: "CommitWithOpenIterator", run: func(ctx context.Context, opts *Options, v *IteratorValidator, begin, end string) error {
+		return endWithOpenIterator(ctx, opts, v, begin, end, true)
+	}},
+	{name: "IteratorReuse", run: iteratorReuse},
+	{name: "GetNextAfterExhaustion", run: getNextAfterExhaustion},
+}
+
+// RunIteratorLifecycleTest checks that iterators behave in a well-defined
+// way, without panics, when the iteration is stopped early, when the tx ends
+// while the iterator is open, when an iterator is used for a second Ascend,
+// and when GetNext is called after the last key. Every case is also checked
+// for goroutines left running by the backend, except in the Parallel mode,
+// where goroutines of other tests cannot be told apart.
+func RunIteratorLifecycleTest(ctx context.Context, opts *Options) error {
+	opts.setDefaults()
+	if err := opts.Check(); err != nil {
+		return err
+	}
+	if _, _, err := FillItems(ctx, opts); err != nil {
+		return err
+	}
+	v := &IteratorValidator{Prefix: opts.Prefix}
+	for i := 0; i < opts.NumKeys; i++ {
+		v.Keys = append(v.Keys, opts.getKey(i))
+	}
+
+	for _, c := range iteratorLifecycleCases {
+		b, e, err := opts.selectRange(10)
+		if err != nil {
+			return err
+		}
+		before := runtime.NumGoroutine()
+		if err := runRecovered(func() error {
+			return c.run(ctx, opts, v, opts.getKey(b), opts.getKey(e))
+		}); err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+		if !opts.Parallel {
+			if err := checkGoroutines(before); err != nil {
+				return fmt.Errorf("%s: %w", c.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// runRecovered runs the function and returns panics as errors.
+func runRecovered(fn func() error) (status error) {
+	defer func() {
+		if r := recover(); r != nil {
+			status = fmt.Errorf("panicked: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// checkGoroutines waits for the number of goroutines to drop to the given
+// count and returns an error with the stacks of all goroutines if it doesn't.
+func checkGoroutines(count int) error {
+	for deadline := time.Now().Add(goroutineWait); time.Now().Before(deadline); {
+		if runtime.NumGoroutine() <= count {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	buf := make([]byte, 64<<10)
+	buf = buf[:runtime.Stack(buf, true)]
+	return fmt.Errorf("%d goroutines are left running:\n%s", runtime.NumGoroutine()-count, buf)
+}
+
+// earlyTermination stops an iteration after the first key and checks that
+// the range can be updated and iterated by the next txes.
+func earlyTermination(ctx context.Context, opts *Options, v *IteratorValidator, begin, end string) error {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	it, err := opts.NewIt(ctx)
+	if err != nil {
+		_ = tx.Discard(ctx)
+		return err
+	}
+	if err := tx.Ascend(ctx, begin, end, it); err != nil {
+		_ = tx.Discard(ctx)
+		return err
+	}
+	if _, _, err := it.GetNext(ctx); err != nil {
+		_ = tx.Discard(ctx)
+		return err
+	}
+	if err := tx.Discard(ctx); err != nil {
+		return err
+	}
+
+	// Locks or other resources held by the iterator must be released, so the
+	// first key can be updated.
+	rewrite := func(ctx context.Context, tx kv.Transaction) error {
+		value, err := tx.Get(ctx, begin)
+		if err != nil {
+			return err
+		}
+		return tx.Set(ctx, begin, value)
+	}
+	if err := updateKeys(ctx, opts, rewrite); err != nil {
+		return fmt.Errorf("could not update the range after the iteration: %w", err)
+	}
+	return validateRange(ctx, opts, v, begin, end)
+}
+
+// endWithOpenIterator commits or discards the tx after the first key is
+// returned and checks that the iterator either returns the remaining keys in
+// the range or fails, and that it ends.
+func endWithOpenIterator(ctx context.Context, opts *Options, v *IteratorValidator, begin, end string, commit bool) error {
+	var want []string
+	for _, k := range v.Keys {
+		if inAscendRange(k, begin, end) {
+			want = append(want, k)
+		}
+	}
+	sort.Strings(want)
+
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	it, err := opts.NewIt(ctx)
+	if err != nil {
+		_ = tx.Discard(ctx)
+		return err
+	}
+	if err := tx.Ascend(ctx, begin, end, it); err != nil {
+		_ = tx.Discard(ctx)
+		return err
+	}
+	if _, _, err := it.GetNext(ctx); err != nil {
+		_ = tx.Discard(ctx)
+		return err
+	}
+	if commit {
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("could not commit a read-only tx: %w", err)
+		}
+	} else if err := tx.Discard(ctx); err != nil {
+		return err
+	}
+
+	for n := 1; n <= len(want); n++ {
+		k, _, err := it.GetNext(ctx)
+		if err != nil {
+			// Any error is a well-defined end of the iteration.
+			return nil
+		}
+		if n == len(want) || k != want[n] {
+			return fmt.Errorf("iterator returned %q after the tx has ended, which is not the next key in the range", k)
+		}
+	}
+	return fmt.Errorf("iterator did not end after the last key in the range")
+}
+
+// iteratorReuse uses the same iterator for a second Ascend after the first
+// one is exhausted. Second Ascend may fail, but if it succeeds, iterator must
+// return the keys in the second range.
+func iteratorReuse(ctx context.Context, opts *Options, v *IteratorValidator, begin, end string) (status error) {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Discard(ctx); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	it, err := opts.NewIt(ctx)
+	if err != nil {
+		return err
+	}
+	if err := tx.Ascend(ctx, begin, end, it); err != nil {
+		return err
+	}
+	if err := v.ValidateAscend(ctx, it, begin, end); err != nil {
+		return err
+	}
+
+	b, e, err := opts.selectRange(5)
+	if err != nil {
+		return err
+	}
+	begin, end = opts.getKey(b), opts.getKey(e)
+	if err := tx.Ascend(ctx, begin, end, it); err != nil {
+		// Rejecting the iterator is a valid way to prevent the reuse.
+		return nil
+	}
+	if err := v.ValidateAscend(ctx, it, begin, end); err != nil {
+		return fmt.Errorf("reused iterator: %w", err)
+	}
+	return nil
+}
+
+// getNextAfterExhaustion checks that GetNext keeps returning os.ErrNotExist
+// after the last key.
+func getNextAfterExhaustion(ctx context.Context, opts *Options, v *IteratorValidator, begin, end string) (status error) {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Discard(ctx); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	it, err := opts.NewIt(ctx)
+	if err != nil {
+		return err
+	}
+	if err := tx.Descend(ctx, begin, end, it); err != nil {
+		return err
+	}
+	if err := v.ValidateDescend(ctx, it, begin, end); err != nil {
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		if k, _, err := it.GetNext(ctx); !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("GetNext after the last key returned %q and error %v, want os.ErrNotExist", k, err)
+		}
+	}
+	return nil
+}
+
+// validateRange checks the range in a new tx.
+func validateRange(ctx context.Context, opts *Options, v *IteratorValidator, begin, end string) (status error) {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Discard(ctx); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	it, err := opts.NewIt(ctx)
+	if err != nil {
+		return err
+	}
+	if err := tx.Ascend(ctx, begin, end, it); err != nil {
+		return err
+	}
+	return v.ValidateAscend(ctx, it, begin, end)
+}
@@ -0,0 +1,295 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bvkgo/kv"
+	"github.com/bvkgo/kvtests/txtest"
+)
+
+// IteratorCase describes what an iterator has returned when a key was
+// inserted into and another key was deleted from its range.
+type IteratorCase struct {
+	// Name identifies the case and the direction of the iteration, e.g.,
+	// "ForeignCommitDuringIteration/descend".
+	Name string `json:"name"`
+
+	// InsertSeen is true when the inserted key was returned and DeleteSeen is
+	// true when the deleted key was returned.
+	InsertSeen bool `json:"insert_seen"`
+	DeleteSeen bool `json:"delete_seen"`
+
+	// Outcome describes the modifying tx of the foreign cases, which is
+	// "committed", "blocked" when it could not commit till the iterating tx
+	// has ended, or its error. It is empty for the own writes cases.
+	Outcome string `json:"outcome,omitempty"`
+
+	// Committed is true when the iterating tx of a foreign case could commit
+	// after the iteration. Foreign writes are a violation only when it could.
+	Committed bool `json:"committed"`
+
+	// Violation describes how the behavior differs from the required
+	// behavior, if any. Cases without a required behavior at the promised
+	// isolation level are only reported.
+	Violation string `json:"violation,omitempty"`
+}
+
+// IteratorReport holds the behavior observed by RunIteratorSnapshotTest.
+type IteratorReport struct {
+	Cases []IteratorCase `json:"cases"`
+}
+
+func (r *IteratorReport) String() string {
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "case\tinsert seen\tdelete seen\toutcome\tcommitted\tviolation")
+	for _, c := range r.Cases {
+		fmt.Fprintf(tw, "%s\t%t\t%t\t%s\t%t\t%s\n", c.Name, c.InsertSeen, c.DeleteSeen, c.Outcome, c.Committed, c.Violation)
+	}
+	tw.Flush()
+	return sb.String()
+}
+
+// iteratorCases lists the cases checked by RunIteratorSnapshotTest. Field
+// foreign is true when the modifications are made by another tx, which must
+// be invisible to the iterator at snapshot isolation and above when the
+// iterating tx can commit, and field
+// during is true when they are made after the first key is returned. Field
+// required is true when the own writes must be visible at all levels.
+var iteratorCases = []struct {
+	name     string
+	foreign  bool
+	during   bool
+	required bool
+}{
+	{name: "OwnWritesBeforeIteration", required: true},
+	{name: "OwnWritesDuringIteration", during: true},
+	{name: "ForeignCommitBeforeIteration", foreign: true},
+	{name: "ForeignCommitDuringIteration", foreign: true, during: true},
+}
+
+// RunIteratorSnapshotTest checks the keys returned by Ascend and Descend
+// iterators when a key is inserted into and another key is deleted from the
+// range, either by the iterating tx or by another tx, before the iteration or
+// after the first key is returned. Own writes made before the iteration must
+// be visible. Iterating tx is committed in the foreign cases, so the commits
+// of other txes must be invisible at snapshot isolation and above unless the
+// backend fails that commit. Other cases are only reported. Returns the
+// report along with an error if any case has a violation.
+func RunIteratorSnapshotTest(ctx context.Context, opts *Options) (*IteratorReport, error) {
+	opts.setDefaults()
+	if err := opts.Check(); err != nil {
+		return nil, err
+	}
+
+	r := new(IteratorReport)
+	for _, c := range iteratorCases {
+		for _, ascend := range []bool{true, false} {
+			name := c.name + "/ascend"
+			if !ascend {
+				name = c.name + "/descend"
+			}
+			ic, err := runIteratorCase(ctx, opts, ascend, c.foreign, c.during)
+			if err != nil {
+				return r, fmt.Errorf("%s: %w", name, err)
+			}
+			ic.Name = name
+			switch {
+			case c.required && (!ic.InsertSeen || ic.DeleteSeen):
+				ic.Violation = "own writes are not visible"
+			case c.foreign && ic.Committed && opts.isolation() >= txtest.SnapshotIsolation && (ic.InsertSeen || !ic.DeleteSeen):
+				ic.Violation = "foreign writes are visible"
+			}
+			r.Cases = append(r.Cases, *ic)
+		}
+	}
+
+	var violations []string
+	for _, c := range r.Cases {
+		if c.Violation != "" {
+			violations = append(violations, c.Name)
+		}
+	}
+	if len(violations) > 0 {
+		return r, fmt.Errorf("iterator behavior violates the guarantees in %s\n%s", strings.Join(violations, ", "), r)
+	}
+	return r, nil
+}
+
+// runIteratorCase iterates over a range of ten keys while a key is inserted
+// into the middle of the range and another key is deleted from it. Modified
+// keys are ahead of the first key in both directions.
+func runIteratorCase(ctx context.Context, opts *Options, ascend, foreign, during bool) (ic *IteratorCase, status error) {
+	if _, _, err := FillItems(ctx, opts); err != nil {
+		return nil, err
+	}
+	b, e, err := opts.selectRange(10)
+	if err != nil {
+		return nil, err
+	}
+	inserted := opts.getKey(b+4) + "-inserted"
+	victim := opts.getKey(b + 5)
+	defer func() {
+		if err := deleteKeys(ctx, opts, inserted); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	ic = new(IteratorCase)
+	modify := func(ctx context.Context, tx kv.Transaction) error {
+		if err := tx.Set(ctx, inserted, inserted); err != nil {
+			return err
+		}
+		return tx.Delete(ctx, victim)
+	}
+
+	// Another tx runs on its own goroutine, because it may block till the
+	// iterating tx ends. Goroutine is joined after the iterating tx has
+	// ended on all returns.
+	var done chan error
+	defer func() {
+		if done != nil {
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if status != nil {
+			_ = tx.Discard(ctx)
+		}
+	}()
+
+	startForeign := func() {
+		ic.Outcome = "committed"
+		done = make(chan error, 1)
+		go func() {
+			done <- updateKeys(ctx, opts, modify)
+		}()
+		wait := opts.BlockWait
+		if wait == 0 {
+			wait = txtest.DefaultBlockWait
+		}
+		select {
+		case err := <-done:
+			done = nil
+			if err != nil {
+				ic.Outcome = err.Error()
+			}
+		case <-time.After(wait):
+			ic.Outcome = "blocked"
+		}
+	}
+	update := func() error {
+		if foreign {
+			startForeign()
+			return nil
+		}
+		return modify(ctx, tx)
+	}
+
+	if foreign {
+		// Snapshot may be taken at the first operation, so the tx reads a key
+		// outside the range before the update.
+		if _, err := tx.Get(ctx, opts.getKey(e%opts.NumKeys)); err != nil {
+			return nil, err
+		}
+	}
+	if !during {
+		if err := update(); err != nil {
+			return nil, err
+		}
+	}
+
+	it, err := opts.NewIt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ascend {
+		err = tx.Ascend(ctx, opts.getKey(b), opts.getKey(e), it)
+	} else {
+		err = tx.Descend(ctx, opts.getKey(b), opts.getKey(e-1), it)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for n := 0; ; n++ {
+		if n == 1 && during {
+			if err := update(); err != nil {
+				return nil, err
+			}
+		}
+		k, _, err := it.GetNext(ctx)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch k {
+		case inserted:
+			ic.InsertSeen = true
+		case victim:
+			ic.DeleteSeen = true
+		}
+	}
+
+	// Blocked tx can complete only after the iterating tx ends. Iterating tx
+	// of the foreign cases is committed, because a backend may detect the
+	// foreign writes only at the commit.
+	if foreign {
+		if err := tx.Commit(ctx); err != nil {
+			_ = tx.Discard(ctx)
+		} else {
+			ic.Committed = true
+		}
+	} else if err := tx.Discard(ctx); err != nil {
+		return nil, err
+	}
+	if done != nil {
+		select {
+		case err := <-done:
+			done = nil
+			if err != nil {
+				ic.Outcome = fmt.Sprintf("blocked: %v", err)
+			}
+		case <-time.After(opts.StepTimeout):
+			// Modifying tx is stuck in the backend, so it is not joined.
+			done = nil
+			return nil, fmt.Errorf("modifying tx did not complete in %v after the iterating tx has ended", opts.StepTimeout)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return ic, nil
+}
+
+// updateKeys runs the update function in a new tx and commits it.
+func updateKeys(ctx context.Context, opts *Options, update func(context.Context, kv.Transaction) error) (status error) {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if status != nil {
+			_ = tx.Discard(ctx)
+		}
+	}()
+
+	if err := update(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,172 @@
+package kvtests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	// modelRounds is the number of random update txes applied by
+	// RunIteratorModelTest and modelQueries is the number of random ranges
+	// checked in each direction after every update.
+	modelRounds  = 4
+	modelQueries = 100
+)
+
+// iteratorModel is the in-memory reference for the keys with the
+// Options.Prefix.
+type iteratorModel struct {
+	values map[string]string
+}
+
+// RunIteratorModelTest applies random sets and deletes to the keys through
+// txes and compares the results of Ascend and Descend for random ranges with
+// an in-memory model. Deletes make the keyspace sparse and range bounds are
+// chosen from existing keys, deleted keys, keys between the existing keys and
+// empty strings. Keys without the Options.Prefix are ignored.
+func RunIteratorModelTest(ctx context.Context, opts *Options) error {
+	opts.setDefaults()
+	if err := opts.Check(); err != nil {
+		return err
+	}
+	if _, _, err := FillItems(ctx, opts); err != nil {
+		return err
+	}
+	m := &iteratorModel{values: make(map[string]string)}
+	for i := 0; i < opts.NumKeys; i++ {
+		m.values[opts.getKey(i)] = opts.getValue(i)
+	}
+
+	for round := 0; round < modelRounds; round++ {
+		// First round deletes most keys to create gaps; later rounds mix sets
+		// and deletes, which may recreate the deleted keys.
+		nops, pdelete := opts.NumKeys/10+1, 0.5
+		if round == 0 {
+			nops, pdelete = opts.NumKeys, 0.7
+		}
+		if err := m.update(ctx, opts, nops, pdelete); err != nil {
+			return fmt.Errorf("round %d: %w", round, err)
+		}
+		for q := 0; q < modelQueries; q++ {
+			i, j := m.randomBound(opts), m.randomBound(opts)
+			if err := m.check(ctx, opts, true, i, j); err != nil {
+				return fmt.Errorf("round %d: %w", round, err)
+			}
+			if err := m.check(ctx, opts, false, i, j); err != nil {
+				return fmt.Errorf("round %d: %w", round, err)
+			}
+		}
+	}
+	return nil
+}
+
+// update applies nops random sets and deletes to the database in a single tx
+// and to the model after the tx is committed. Every operation is a delete
+// with probability pdelete.
+func (m *iteratorModel) update(ctx context.Context, opts *Options, nops int, pdelete float64) (status error) {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if status != nil {
+			_ = tx.Discard(ctx)
+		}
+	}()
+
+	updates := make(map[string]*string)
+	for n := 0; n < nops; n++ {
+		key := opts.getKey(opts.rand.Intn(opts.NumKeys))
+		if opts.rand.Float64() < pdelete {
+			if err := tx.Delete(ctx, key); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			updates[key] = nil
+			continue
+		}
+		value := fmt.Sprintf("v%d", opts.rand.Int63())
+		if opts.Values != nil {
+			value = opts.Values.value(opts.rand)
+		}
+		if err := tx.Set(ctx, key, value); err != nil {
+			return err
+		}
+		updates[key] = &value
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("could not commit the updates: %w", err)
+	}
+
+	for k, v := range updates {
+		if v == nil {
+			delete(m.values, k)
+		} else {
+			m.values[k] = *v
+		}
+	}
+	return nil
+}
+
+// randomBound returns an empty string, an existing key, a deleted key, a key
+// between two keys or a bound around the whole namespace.
+func (m *iteratorModel) randomBound(opts *Options) string {
+	key := opts.getKey(opts.rand.Intn(opts.NumKeys))
+	switch opts.rand.Intn(6) {
+	case 0:
+		return ""
+	case 1:
+		// Keys are not prefixes of other keys, so this falls between key and
+		// the next key.
+		return key + "\x00"
+	case 2:
+		begin, end := opts.ascendRange()
+		if opts.rand.Intn(2) == 0 {
+			return begin
+		}
+		return end
+	case 3:
+		for n := 0; n < 10; n++ {
+			k := opts.getKey(opts.rand.Intn(opts.NumKeys))
+			if _, ok := m.values[k]; !ok {
+				return k
+			}
+		}
+	}
+	// Either an existing or a deleted key.
+	return key
+}
+
+// check compares the result of Ascend or Descend for the bounds with the
+// model.
+func (m *iteratorModel) check(ctx context.Context, opts *Options, ascend bool, i, j string) (status error) {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Discard(ctx); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	it, err := opts.NewIt(ctx)
+	if err != nil {
+		return err
+	}
+	v := &IteratorValidator{Values: m.values, Prefix: opts.Prefix}
+	for k := range m.values {
+		v.Keys = append(v.Keys, k)
+	}
+	if ascend {
+		if err := tx.Ascend(ctx, i, j, it); err != nil {
+			return fmt.Errorf("ascend(%q, %q) failed: %w", i, j, err)
+		}
+		return v.ValidateAscend(ctx, it, i, j)
+	}
+	if err := tx.Descend(ctx, i, j, it); err != nil {
+		return fmt.Errorf("descend(%q, %q) failed: %w", i, j, err)
+	}
+	return v.ValidateDescend(ctx, it, i, j)
+}
@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bvkgo/kv"
+	"github.com/bvkgo/kvtests/txtest"
 )
 
 type Options struct {
@@ -17,13 +21,86 @@ type Options struct {
 
 	NumKeys int
 
+	// Prefix is prepended to all keys created by the tests, so that the tests
+	// can share a database with other data. Iterator tests only iterate over
+	// the keys with the prefix.
+	Prefix string
+
+	// KeyFormat returns the key for an index, which is prepended with the
+	// Prefix. Keys must be in the same order as their indexes and no key may
+	// be a prefix of another key. Defaults to the "%08d" format.
+	KeyFormat func(i int) string
+
+	// Values generates the values stored by FillItems, which stores every key
+	// as its own value when nil. Values are read back and verified after
+	// they are written.
+	Values *ValueGenerator
+
+	// Concurrent runs every tx in the isolation tests on its own goroutine,
+	// which is necessary for backends that block conflicting operations. A
+	// step is considered blocked if it doesn't complete within the BlockWait
+	// duration, which defaults to txtest.DefaultBlockWait.
+	Concurrent bool
+	BlockWait  time.Duration
+
+	// StepTimeout is the deadline for every step in the isolation tests, in
+	// addition to the deadline on the context. Defaults to 10 seconds.
+	StepTimeout time.Duration
+
+	// Guarantees describes the isolation guarantees promised by the backend.
+	// Nil means the backend is serializable and supports concurrent writers.
+	Guarantees *Guarantees
+
+	// Teardown deletes the keys created by every test run by the RunAll
+	// functions when it ends, and checks that no keys with the Prefix are left
+	// behind when the Prefix is not empty. See the Teardown function.
+	Teardown bool
+
+	// Parallel runs the tests as parallel subtests, where every test appends
+	// its name to the Prefix. Parallel subtests run after the RunAll functions
+	// return, so the backend should be closed with t.Cleanup. They keep the
+	// values of the context passed to the RunAll functions, but not its
+	// deadline or cancellation, which usually ends before they run.
+	Parallel bool
+
+	// ReportResult receives the result of every isolation scenario, including
+	// the passing ones, which are not returned otherwise. It is called once
+	// the steps have run and violations found by the later checks are added to
+	// the same result before the scenario returns. It may be called
+	// concurrently by parallel subtests.
+	ReportResult func(r *ScenarioResult)
+
 	rand *rand.Rand
 }
 
+// Guarantees describes the isolation level and the capabilities of a backend,
+// which RunAllIsolationTests uses to select the scenarios and their expected
+// outcomes. Anomalies permitted by the isolation level are not reported as
+// failures.
+type Guarantees struct {
+	// Isolation is the isolation level promised by the backend. Unspecified
+	// level is taken as Serializable.
+	Isolation txtest.IsolationLevel
+
+	// SerialWriters is true when the backend allows only one tx with writes
+	// at a time and blocks the writes of other txes till it ends. Isolation
+	// tests are run in the concurrent mode for such backends and scenarios
+	// that require concurrent writers are not run.
+	SerialWriters bool
+
+	// BlockingReads is true when the backend blocks the reads of keys written
+	// by an uncommitted tx till the writer tx ends. Scenarios are always run
+	// in the concurrent mode for such backends.
+	BlockingReads bool
+}
+
 func (opts *Options) setDefaults() {
 	if opts.NumKeys == 0 {
 		opts.NumKeys = 1000
 	}
+	if opts.StepTimeout == 0 {
+		opts.StepTimeout = 10 * time.Second
+	}
 	if opts.Seed == 0 {
 		opts.Seed = time.Now().UnixNano()
 	}
@@ -34,11 +111,96 @@ func (opts *Options) Check() error {
 	if opts.NewTx == nil || opts.NewIt == nil {
 		return fmt.Errorf("NewTx and NewIt fields are required: %w", os.ErrInvalid)
 	}
+	if opts.Values != nil {
+		if err := opts.Values.check(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// isolation returns the isolation level promised by the backend.
+func (opts *Options) isolation() txtest.IsolationLevel {
+	if opts.Guarantees == nil || opts.Guarantees.Isolation == txtest.IsolationUnspecified {
+		return txtest.Serializable
+	}
+	return opts.Guarantees.Isolation
+}
+
+// serialWriters returns true if the backend doesn't support concurrent
+// writers.
+func (opts *Options) serialWriters() bool {
+	return opts.Guarantees != nil && opts.Guarantees.SerialWriters
+}
+
+// reportResult passes the scenario result to the ReportResult function, if
+// any.
+func (opts *Options) reportResult(r *ScenarioResult) {
+	if opts.ReportResult != nil {
+		opts.ReportResult(r)
+	}
+}
+
+// blockingReads returns true if the backend blocks the reads of uncommitted
+// writes.
+func (opts *Options) blockingReads() bool {
+	return opts.Guarantees != nil && opts.Guarantees.BlockingReads
+}
+
 func (opts *Options) getKey(i int) string {
-	return fmt.Sprintf("%08d", i)
+	if opts.KeyFormat != nil {
+		return opts.Prefix + opts.KeyFormat(i)
+	}
+	return fmt.Sprintf("%s%08d", opts.Prefix, i)
+}
+
+// keyIndex returns the index of a key created by getKey.
+func (opts *Options) keyIndex(key string) (int, error) {
+	if !strings.HasPrefix(key, opts.Prefix) {
+		return -1, fmt.Errorf("key %q doesn't have the prefix %q", key, opts.Prefix)
+	}
+	if opts.KeyFormat == nil {
+		v, err := strconv.Atoi(strings.TrimPrefix(key, opts.Prefix))
+		if err != nil {
+			return -1, fmt.Errorf("could not parse key to int: %w", err)
+		}
+		return v, nil
+	}
+	// Keys are in the order of their indexes.
+	i := sort.Search(opts.NumKeys, func(i int) bool { return opts.getKey(i) >= key })
+	if i == opts.NumKeys || opts.getKey(i) != key {
+		return -1, fmt.Errorf("key %q is not created by the tests", key)
+	}
+	return i, nil
+}
+
+// ascendRange returns the bounds for Ascend that cover all keys with the
+// Prefix. Both bounds are empty when there is no prefix. Otherwise, end is
+// the smallest key larger than all keys with the prefix, which is empty when
+// there is no such key.
+func (opts *Options) ascendRange() (begin, end string) {
+	if len(opts.Prefix) == 0 {
+		return "", ""
+	}
+	p := []byte(opts.Prefix)
+	for i := len(p) - 1; i >= 0; i-- {
+		if p[i] < 0xff {
+			p[i]++
+			return opts.Prefix, string(p[:i+1])
+		}
+	}
+	return opts.Prefix, ""
+}
+
+// descendRange returns the bounds for Descend that cover all keys with the
+// Prefix. Both bounds are empty when there is no prefix. Otherwise, begin is
+// the exclusive lower bound and end is the largest key created by the tests,
+// because the upper bound is inclusive.
+func (opts *Options) descendRange() (begin, end string) {
+	if len(opts.Prefix) == 0 {
+		return "", ""
+	}
+	return opts.Prefix, opts.getKey(opts.NumKeys - 1)
 }
 
 func (opts *Options) selectKeys(n int) ([]string, error) {
@@ -50,14 +212,28 @@ func (opts *Options) selectKeys(n int) ([]string, error) {
 	usedKeys := make(map[int]struct{})
 	for i := 0; i < n; i++ {
 		k := opts.rand.Intn(opts.NumKeys)
-		for _, ok := usedKeys[k]; ok; {
+		for _, ok := usedKeys[k]; ok; _, ok = usedKeys[k] {
 			k = opts.rand.Intn(opts.NumKeys)
 		}
+		usedKeys[k] = struct{}{}
 		keys = append(keys, opts.getKey(k))
 	}
+	// Keys are returned in sorted order so that range operations over the key
+	// ids (e.g., ascend-k1-k5) cover the same keys in every run.
+	sort.Strings(keys)
 	return keys, nil
 }
 
+// selectRange returns a randomly chosen range [b, e) of key indexes with
+// exactly 'n' keys.
+func (opts *Options) selectRange(n int) (int, int, error) {
+	if opts.NumKeys < n {
+		return -1, -1, fmt.Errorf("at least %d keys are required", n)
+	}
+	b := opts.rand.Intn(opts.NumKeys - n + 1)
+	return b, b + n, nil
+}
+
 // selectKeySets retrieves 'nset' slices of each with 'nkey' randomly chosen
 // non-duplicate keys.
 func (opts *Options) selectKeySets(nset, nkey int) ([][]string, error) {
@@ -0,0 +1,68 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bvkgo/kvtests/txtest"
+)
+
+// RunRandomIsolationTests runs n random tests as subtests, with seeds
+// starting from the Options.Seed. Failures report the seed and the test in
+// the ".txn" file format, so that it can be saved as a regression test.
+func RunRandomIsolationTests(t *testing.T, ctx context.Context, opts *Options, level txtest.IsolationLevel, wopts *txtest.WorkloadOptions, n int) {
+	opts.setDefaults()
+	for i := 0; i < n; i++ {
+		ropts := *opts
+		ropts.Seed = opts.Seed + int64(i)
+		t.Run(fmt.Sprintf("seed-%d", ropts.Seed), func(t *testing.T) {
+			run := func(ctx context.Context, opts *Options) error {
+				return RandomTxes(ctx, opts, level, wopts)
+			}
+			if err := runWithTeardown(ctx, &ropts, run); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// RandomTxes runs a random test generated from the Options.Seed and checks
+// that its outcome is serializable when the level is Serializable. History of
+// the run is also checked for the phenomena proscribed by the level.
+func RandomTxes(ctx context.Context, opts *Options, level txtest.IsolationLevel, wopts *txtest.WorkloadOptions) error {
+	opts.setDefaults()
+	steps, err := txtest.GenerateSteps(opts.rand, wopts)
+	if err != nil {
+		return err
+	}
+	it, err := runIsolationTestAt(ctx, opts, level, steps)
+	if err == nil {
+		err = checkHistory(it, level)
+	}
+	if err != nil {
+		s := &txtest.Scenario{
+			Name:      fmt.Sprintf("random-%d", opts.Seed),
+			Isolation: level,
+			Steps:     steps,
+		}
+		return fmt.Errorf("seed %d: %w\n%s", opts.Seed, err, txtest.FormatScenario(s))
+	}
+	return nil
+}
+
+// checkHistory returns an error listing the phenomena in the history of the
+// most recent run that are proscribed by the level.
+func checkHistory(it *txtest.IsolationTest, level txtest.IsolationLevel) error {
+	var found []string
+	for _, p := range txtest.CheckHistory(it.History()) {
+		if level.Proscribes(p.Name) {
+			found = append(found, p.String())
+		}
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("history has phenomena proscribed at %s: %s", level, strings.Join(found, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package kvtests
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bvkgo/kvtests/txtest"
+)
+
+// ScenarioResult describes the outcome of an isolation test scenario. It can
+// be printed as a table with the String method or encoded as JSON.
+type ScenarioResult struct {
+	Name string `json:"name"`
+	Seed int64  `json:"seed"`
+
+	// Keys holds the keys used in place of the key ids, i.e., Keys[0] is used
+	// for k0.
+	Keys []string `json:"keys,omitempty"`
+
+	// Txes holds the outcome of every tx.
+	Txes []TxOutcome `json:"txes,omitempty"`
+
+	// Steps holds the outcome of every step.
+	Steps []StepOutcome `json:"steps,omitempty"`
+
+	// Final holds the final values of the keys.
+	Final []string `json:"final,omitempty"`
+
+	// Violations describes the unmet expectations and the anomalies found.
+	Violations []string `json:"violations,omitempty"`
+}
+
+// TxOutcome describes how a tx has ended.
+type TxOutcome struct {
+	Tx int `json:"tx"`
+
+	// Outcome is one of "committed", "aborted", "failed", "unknown" when the
+	// commit or abort has timed out, or "not-run" when the run has stopped
+	// before the tx could end.
+	Outcome string `json:"outcome"`
+
+	// Err is the error message for failed and unknown txes.
+	Err string `json:"error,omitempty"`
+}
+
+// StepOutcome describes the outcome of a step.
+type StepOutcome struct {
+	Line   int    `json:"line"`
+	Step   string `json:"step"`
+	Status string `json:"status"`
+
+	// Result holds the value returned by a get step or the key ids returned
+	// by a scan, ascend or descend step.
+	Result string `json:"result,omitempty"`
+}
+
+// ScenarioError is returned when a scenario fails a check. It holds the
+// scenario result, which can be extracted with errors.As.
+type ScenarioError struct {
+	Result *ScenarioResult
+	Err    error
+}
+
+func (e *ScenarioError) Error() string {
+	return fmt.Sprintf("%v\n%s", e.Err, e.Result)
+}
+
+func (e *ScenarioError) Unwrap() error {
+	return e.Err
+}
+
+// newScenarioResult returns the result for the most recent run of the test,
+// which may be nil if the test could not run.
+func newScenarioResult(name string, opts *Options, it *txtest.IsolationTest) *ScenarioResult {
+	r := &ScenarioResult{Name: name, Seed: opts.Seed}
+	if it == nil {
+		return r
+	}
+
+	r.Keys = it.Keys()
+	r.Final = it.Values()
+	committed, results := it.Committed(), it.Results()
+	for tx := 0; tx < it.NumTx(); tx++ {
+		o := TxOutcome{Tx: tx, Outcome: "aborted"}
+		if results[tx] != nil {
+			o.Err = results[tx].Error()
+		}
+		status := it.StepResultAtLine(it.EndLine(tx)).Status
+		switch {
+		case committed[tx]:
+			o.Outcome = "committed"
+		case status == txtest.StepTimedOut:
+			o.Outcome = "unknown"
+		case results[tx] != nil:
+			o.Outcome = "failed"
+		case status == txtest.StepNotRun:
+			o.Outcome = "not-run"
+		}
+		r.Txes = append(r.Txes, o)
+	}
+
+	ids := make(map[string]string)
+	for i, k := range r.Keys {
+		ids[k] = fmt.Sprintf("k%d", i)
+	}
+	for line, step := range it.Steps() {
+		// Final values are reported separately.
+		if strings.HasPrefix(step, "final:") {
+			continue
+		}
+		sr := it.StepResultAtLine(line)
+		s := StepOutcome{Line: line, Step: step, Status: sr.Status.String()}
+		if sr.Status == txtest.StepSucceeded {
+			if kvs := it.ScanResultAtLine(line); kvs != nil {
+				var ks []string
+				for _, kv := range kvs {
+					ks = append(ks, ids[kv.Key])
+				}
+				s.Result = strings.Join(ks, ",")
+			} else {
+				s.Result = it.GetResultAtLine(line)
+			}
+		}
+		r.Steps = append(r.Steps, s)
+	}
+
+	if msgs, err := it.UnmetExpectations(); err == nil {
+		r.Violations = append(r.Violations, msgs...)
+	}
+	return r
+}
+
+// fail records the error as a violation and returns it as a ScenarioError.
+// Unmet expectations are not recorded again, because they are already
+// included in the result.
+func (r *ScenarioResult) fail(err error) error {
+	if !errors.Is(err, txtest.ErrUnexpected) {
+		r.Violations = append(r.Violations, err.Error())
+	}
+	return &ScenarioError{Result: r, Err: err}
+}
+
+func (r *ScenarioResult) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "scenario %s (seed %d)\n", r.Name, r.Seed)
+
+	tw := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	if len(r.Steps) > 0 {
+		fmt.Fprintln(tw, "line\tstep\tstatus\tresult")
+		for _, s := range r.Steps {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Line, abbrev(s.Step), s.Status, abbrev(s.Result))
+		}
+		fmt.Fprintln(tw)
+	}
+	if len(r.Txes) > 0 {
+		fmt.Fprintln(tw, "tx\toutcome\terror")
+		for _, o := range r.Txes {
+			fmt.Fprintf(tw, "t%d\t%s\t%s\n", o.Tx, o.Outcome, o.Err)
+		}
+		fmt.Fprintln(tw)
+	}
+	if len(r.Keys) > 0 {
+		fmt.Fprintln(tw, "id\tkey\tfinal")
+		for i, k := range r.Keys {
+			final := ""
+			if i < len(r.Final) {
+				final = r.Final[i]
+			}
+			fmt.Fprintf(tw, "k%d\t%s\t%s\n", i, abbrev(k), abbrev(final))
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	for _, v := range r.Violations {
+		fmt.Fprintf(&sb, "violation: %s\n", v)
+	}
+	return sb.String()
+}
+
+// abbrev returns a short, printable form of a step or a value for the table.
+func abbrev(s string) string {
+	const max = 48
+	if len(s) > max {
+		s = s[:max] + "..."
+	}
+	if !utf8.ValidString(s) || strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
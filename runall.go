@@ -0,0 +1,64 @@
+package kvtests
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// RunAll runs the iterator tests followed by the isolation tests. Iterator
+// tests run first, because they expect no other keys with the Options.Prefix
+// than the keys created by FillItems.
+func RunAll(t *testing.T, ctx context.Context, opts *Options) {
+	opts.setDefaults()
+	t.Run("Iterator", func(t *testing.T) {
+		RunAllIteratorTests(t, ctx, opts)
+	})
+	t.Run("Isolation", func(t *testing.T) {
+		RunAllIsolationTests(t, ctx, opts)
+	})
+}
+
+// runSubtest runs the test function as a subtest with a copy of the options,
+// so that the subtests do not share any state. Parallel subtests use the
+// subtest name as the key prefix. Seed is logged on failure to reproduce the
+// test with the same keys.
+func runSubtest(t *testing.T, ctx context.Context, opts *Options, name string, parallel bool, fn func(context.Context, *Options) error) {
+	runSubtestT(t, ctx, opts, name, parallel, func(_ *testing.T, ctx context.Context, opts *Options) error {
+		return fn(ctx, opts)
+	})
+}
+
+// runSubtestT is like runSubtest, but also passes the subtest to the function.
+// Parallel subtests run after the caller has returned, when its context may be
+// canceled, so they use a context that is canceled when the subtest ends.
+func runSubtestT(t *testing.T, ctx context.Context, opts *Options, name string, parallel bool, fn func(*testing.T, context.Context, *Options) error) {
+	sopts := *opts
+	t.Run(name, func(t *testing.T) {
+		sctx := ctx
+		if parallel {
+			t.Parallel()
+			sopts.Prefix = opts.Prefix + name + "/"
+			var cancel context.CancelFunc
+			sctx, cancel = context.WithCancel(detachedContext{ctx})
+			t.Cleanup(cancel)
+		}
+		run := func(ctx context.Context, opts *Options) error {
+			return fn(t, ctx, opts)
+		}
+		if err := runWithTeardown(sctx, &sopts, run); err != nil {
+			t.Error(err)
+			t.Logf("reproduce with Options.Seed = %d", sopts.Seed)
+		}
+	})
+}
+
+// detachedContext holds the values of a context without its deadline and
+// cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
@@ -0,0 +1,48 @@
+package kvtests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bvkgo/kvtests/txtest"
+)
+
+// RunIsolationTestFiles loads all scenarios from the ".txn" files in the
+// directory and runs each of them as a subtest named after the scenario.
+// Scenarios that require a stronger isolation level than the promised level
+// are skipped. See txtest.ParseScenario for the file format and the testdata
+// directory of this module for examples.
+func RunIsolationTestFiles(t *testing.T, ctx context.Context, opts *Options, dir string) {
+	scenarios, err := txtest.LoadScenarios(dir)
+	if err != nil {
+		t.Fatalf("could not load scenarios from %q: %v", dir, err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatalf("no scenarios found in %q", dir)
+	}
+
+	for _, s := range scenarios {
+		s := s
+		t.Run(s.Name, func(t *testing.T) {
+			if l := opts.isolation(); l < s.Isolation {
+				t.Skipf("scenario requires %s isolation, backend promises %s", s.Isolation, l)
+			}
+			run := func(ctx context.Context, opts *Options) error {
+				_, err := RunScenario(ctx, opts, s)
+				return err
+			}
+			if err := runWithTeardown(ctx, opts, run); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// RunScenario runs the scenario steps and checks the expected results in the
+// steps. Outcome is also checked for serializability when the scenario
+// requires the Serializable isolation level. Returns the result of the run,
+// which is also included in the ScenarioError on failures.
+func RunScenario(ctx context.Context, opts *Options, s *txtest.Scenario) (*ScenarioResult, error) {
+	_, r, err := runScenario(ctx, opts, s.Name, s.Isolation, s.Steps)
+	return r, err
+}
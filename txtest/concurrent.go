@@ -0,0 +1,189 @@
+package txtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bvkgo/kv"
+)
+
+// DefaultBlockWait is the default duration to wait for a step to complete
+// before it is considered blocked in the concurrent mode.
+const DefaultBlockWait = 100 * time.Millisecond
+
+// SetConcurrent enables the concurrent mode, where every tx runs on its own
+// goroutine. Steps are still issued in the order they appear, but a step that
+// doesn't complete within the wait duration is recorded as blocked and the
+// following steps of other txes are issued without waiting for it. Steps of
+// a tx are always executed in order, so they are queued behind a blocked
+// step of the same tx.
+//
+// This mode allows testing backends with lock-based concurrency control,
+// which would block the test runner otherwise. Unlike the sequential mode, a
+// failed operation in this mode fails only its tx, so that backends which
+// abort txes on a deadlock can be tested. Steps that are still blocked after
+// all steps are issued are canceled and their txes are reported as failed.
+func (it *IsolationTest) SetConcurrent(wait time.Duration) {
+	if wait <= 0 {
+		wait = DefaultBlockWait
+	}
+	it.concurrent = true
+	it.blockWait = wait
+}
+
+// BlockedLines returns the indexes of the steps that were blocked in the most
+// recent run in the concurrent mode.
+func (it *IsolationTest) BlockedLines() []int {
+	var lines []int
+	for line := range it.blocked {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// IsBlockedAtLine returns true if the step at the given index was blocked in
+// the most recent run in the concurrent mode.
+func (it *IsolationTest) IsBlockedAtLine(index int) bool {
+	return it.blocked[index]
+}
+
+// txOp holds a step issued to a tx goroutine.
+type txOp struct {
+	line int
+	ps   *parsedStep
+	res  stepResult
+
+	// skipped is true if the step was not executed, because an earlier step
+	// of the tx has failed.
+	skipped bool
+}
+
+// runTx executes the ops of a single tx in order and sends them back through
+// the done channel.
+func runTx(ctx context.Context, timeout time.Duration, newTx kv.NewTxFunc, newIt kv.NewIterFunc, keys []string, ops <-chan *txOp, done chan<- *txOp) {
+	var tx kv.Transaction
+	failed := false
+	for op := range ops {
+		if failed {
+			op.skipped = true
+			done <- op
+			continue
+		}
+		op.res = execStepWithTimeout(ctx, timeout, newTx, newIt, &tx, op.ps, keys)
+		if op.res.err != nil {
+			failed = true
+			if tx != nil {
+				_ = tx.Discard(ctx)
+				tx = nil
+			}
+		}
+		done <- op
+	}
+	if tx != nil {
+		_ = tx.Discard(ctx)
+	}
+}
+
+func (it *IsolationTest) runConcurrent(ctx context.Context, newTx kv.NewTxFunc, newIt kv.NewIterFunc, keys []string) error {
+	if err := clearKeys(ctx, newTx, keys); err != nil {
+		return fmt.Errorf("could not clear keys %v: %w", keys, err)
+	}
+
+	txctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan *txOp, len(it.steps))
+	queues := make([]chan *txOp, it.ntx)
+	for i := range queues {
+		queues[i] = make(chan *txOp, len(it.steps))
+		go runTx(txctx, it.stepTimeout, newTx, newIt, keys, queues[i], done)
+	}
+	defer func() {
+		for _, q := range queues {
+			close(q)
+		}
+	}()
+
+	// pending holds the number of incomplete steps for each tx.
+	pending := make([]int, it.ntx)
+	npending := 0
+
+	complete := func(op *txOp) {
+		pending[op.ps.tx]--
+		npending--
+		if op.skipped {
+			return
+		}
+		if op.res.err != nil && it.results[op.ps.tx] == nil {
+			it.results[op.ps.tx] = fmt.Errorf("%s in line %d failed: %w", opName(op.ps.re), op.line, op.res.err)
+		}
+		it.record(op.line, op.ps, op.res, keys)
+	}
+
+	// waitFor collects the completed steps till the target step is complete
+	// or the timer expires. Returns false if the timer expires.
+	waitFor := func(target *txOp, wait time.Duration) bool {
+		if target == nil && npending == 0 {
+			return true
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		for {
+			select {
+			case op := <-done:
+				complete(op)
+				if op == target || (target == nil && npending == 0) {
+					return true
+				}
+			case <-timer.C:
+				return false
+			}
+		}
+	}
+
+	for line, step := range it.steps {
+		ps, err := parseStep(step)
+		if err != nil {
+			return os.ErrInvalid
+		}
+		// Final values are checked only after all steps are executed.
+		if ps.re == FinalRe {
+			continue
+		}
+
+		op := &txOp{line: line, ps: ps}
+		queued := pending[ps.tx] > 0
+		pending[ps.tx]++
+		npending++
+		queues[ps.tx] <- op
+
+		// Step is queued behind a blocked step of the same tx.
+		if queued {
+			continue
+		}
+		if !waitFor(op, it.blockWait) {
+			it.blocked[line] = true
+			continue
+		}
+
+		// Completing a tx may release the locks for the blocked steps, so give
+		// them a chance to complete before issuing the next step.
+		if npending > 0 && (ps.re == CommitRe || ps.re == AbortRe) {
+			waitFor(nil, it.blockWait)
+		}
+	}
+
+	// Steps that are still blocked are deadlocked, so cancel them.
+	if npending > 0 && !waitFor(nil, it.blockWait) {
+		cancel()
+		if !waitFor(nil, 10*it.blockWait) {
+			return fmt.Errorf("steps blocked at lines %v could not be canceled", it.BlockedLines())
+		}
+	}
+
+	return it.checkCommits()
+}
@@ -0,0 +1,258 @@
+package txtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ednKeyword is an EDN keyword without the leading colon.
+type ednKeyword string
+
+// parseEDN reads the subset of EDN used by Jepsen histories and returns the
+// top-level forms. Maps are returned as map[interface{}]interface{}, vectors
+// and lists as []interface{}, keywords as ednKeyword, integers as int64,
+// floats as float64, and nil as nil. Tagged elements are read as the element
+// without the tag.
+func parseEDN(r io.Reader) ([]interface{}, error) {
+	p := &ednParser{r: bufio.NewReader(r), line: 1}
+	var forms []interface{}
+	for {
+		v, err := p.next()
+		if err == io.EOF {
+			return forms, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("edn line %d: %w", p.line, err)
+		}
+		forms = append(forms, v)
+	}
+}
+
+type ednParser struct {
+	r    *bufio.Reader
+	line int
+	last rune
+}
+
+// closing is returned by next when a collection delimiter is read.
+type closing rune
+
+func (c closing) Error() string {
+	return fmt.Sprintf("unexpected %q", rune(c))
+}
+
+func (p *ednParser) read() (rune, error) {
+	c, _, err := p.r.ReadRune()
+	if c == '\n' {
+		p.line++
+	}
+	p.last = c
+	return c, err
+}
+
+func (p *ednParser) unread() {
+	if p.last == '\n' {
+		p.line--
+	}
+	_ = p.r.UnreadRune()
+}
+
+// skip consumes white space, commas and comments.
+func (p *ednParser) skip() error {
+	for {
+		c, err := p.read()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == ';':
+			if _, err := p.r.ReadString('\n'); err != nil {
+				return err
+			}
+			p.line++
+		case c == ',' || unicode.IsSpace(c):
+		default:
+			p.unread()
+			return nil
+		}
+	}
+}
+
+// next returns the next form.
+func (p *ednParser) next() (interface{}, error) {
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	c, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case '{':
+		return p.readMap()
+	case '[':
+		return p.readSeq(']')
+	case '(':
+		return p.readSeq(')')
+	case '#':
+		c, err := p.read()
+		if err != nil {
+			return nil, err
+		}
+		if c == '{' {
+			return p.readSeq('}')
+		}
+		p.unread()
+		// Tag is ignored.
+		if _, err := p.token(); err != nil {
+			return nil, err
+		}
+		return p.next()
+	case ']', ')', '}':
+		return nil, closing(c)
+	case '"':
+		return p.readString()
+	case ':':
+		tok, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		return ednKeyword(tok), nil
+	}
+	p.unread()
+	tok, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case "nil":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(strings.TrimSuffix(tok, "N"), 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(strings.TrimSuffix(tok, "M"), 64); err == nil {
+		return f, nil
+	}
+	// Symbols are read as strings.
+	return tok, nil
+}
+
+// token reads the characters till the next delimiter.
+func (p *ednParser) token() (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := p.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if unicode.IsSpace(c) || strings.ContainsRune(",()[]{}\";", c) {
+			p.unread()
+			break
+		}
+		sb.WriteRune(c)
+	}
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("empty token: %w", os.ErrInvalid)
+	}
+	return sb.String(), nil
+}
+
+// readSeq reads the elements of a vector, list or set till the end
+// delimiter.
+func (p *ednParser) readSeq(end rune) ([]interface{}, error) {
+	vs := []interface{}{}
+	for {
+		v, err := p.next()
+		if c, ok := err.(closing); ok {
+			if rune(c) != end {
+				return nil, fmt.Errorf("%v instead of %q: %w", c, end, os.ErrInvalid)
+			}
+			return vs, nil
+		}
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+}
+
+func (p *ednParser) readMap() (map[interface{}]interface{}, error) {
+	vs, err := p.readSeq('}')
+	if err != nil {
+		return nil, err
+	}
+	if len(vs)%2 != 0 {
+		return nil, fmt.Errorf("map has odd number of forms: %w", os.ErrInvalid)
+	}
+	m := make(map[interface{}]interface{})
+	for i := 0; i < len(vs); i += 2 {
+		switch vs[i].(type) {
+		case []interface{}, map[interface{}]interface{}:
+			return nil, fmt.Errorf("unsupported map key %v: %w", vs[i], os.ErrInvalid)
+		}
+		m[vs[i]] = vs[i+1]
+	}
+	return m, nil
+}
+
+func (p *ednParser) readString() (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := p.read()
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			e, err := p.read()
+			if err != nil {
+				return "", err
+			}
+			switch e {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			case 'u':
+				var hex [4]rune
+				for i := range hex {
+					if hex[i], err = p.read(); err != nil {
+						return "", err
+					}
+				}
+				n, err := strconv.ParseUint(string(hex[:]), 16, 32)
+				if err != nil {
+					return "", fmt.Errorf("invalid unicode escape: %w", os.ErrInvalid)
+				}
+				sb.WriteRune(rune(n))
+			default:
+				sb.WriteRune(e)
+			}
+		default:
+			sb.WriteRune(c)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package txtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUnexpected is returned when results of a test run do not match the
+// expected results in the steps.
+var ErrUnexpected = errors.New("unexpected result")
+
+// CheckExpectations compares the results of the most recent Run with the
+// expected results given in the steps. Returns an error wrapping
+// ErrUnexpected that lists every step with a mismatch.
+func (it *IsolationTest) CheckExpectations() error {
+	msgs, err := it.UnmetExpectations()
+	if err != nil {
+		return err
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnexpected, strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// UnmetExpectations returns a description of every step whose result in the
+// most recent Run doesn't match the expected results given in the step.
+func (it *IsolationTest) UnmetExpectations() ([]string, error) {
+	if it.keys == nil {
+		return nil, fmt.Errorf("test must be run before the check: %w", os.ErrInvalid)
+	}
+
+	var msgs []string
+	for line, step := range it.steps {
+		ps, err := parseStep(step)
+		if err != nil {
+			return nil, err
+		}
+		if ps.expect == nil {
+			continue
+		}
+
+		var got string
+		switch ps.re {
+		case GetRe:
+			got = it.gets[line]
+		case ScanRe, AscendRe, DescendRe:
+			got = it.scanKeyIDs(line)
+		case CommitRe:
+			got = it.commitResult(ps.tx)
+		case FinalRe:
+			got = it.values[ps.key]
+		}
+
+		if !it.matchExpected(ps, got) {
+			want := make([]string, len(ps.expect))
+			for i, e := range ps.expect {
+				want[i] = abbrevValue(e)
+			}
+			msgs = append(msgs, fmt.Sprintf("line %d %q: got %s, want %s", line, abbrevStep(step), abbrevValue(got), strings.Join(want, "|")))
+		}
+	}
+	return msgs, nil
+}
+
+// commitResult returns "ok" if the tx has committed, "error" if its commit or
+// abort has timed out or failed because of the context or an invalid use of
+// the tx, "conflict" if its commit has failed for any other reason and
+// "not-run" if its commit was not executed.
+func (it *IsolationTest) commitResult(tx int) string {
+	err := it.results[tx]
+	for line, step := range it.steps {
+		ps, perr := parseStep(step)
+		if perr != nil || ps.tx != tx || ps.re != CommitRe {
+			continue
+		}
+		switch it.stepResults[line].Status {
+		case StepNotRun:
+			if err == nil {
+				return "not-run"
+			}
+		case StepTimedOut:
+			return "error"
+		}
+		if err == nil {
+			return "ok"
+		}
+		for _, target := range []error{context.Canceled, context.DeadlineExceeded, os.ErrInvalid, os.ErrClosed} {
+			if errors.Is(err, target) {
+				return "error"
+			}
+		}
+		return "conflict"
+	}
+	return "error"
+}
+
+// matchExpected returns true if the result matches one of the expected
+// results of the step.
+func (it *IsolationTest) matchExpected(ps *parsedStep, result string) bool {
+	for _, e := range ps.expect {
+		if e == result {
+			return true
+		}
+		if e == "initial" && (ps.re == GetRe || ps.re == FinalRe) && result == it.keys[ps.key] {
+			return true
+		}
+	}
+	return false
+}
+
+// scanKeyIDs returns the key-ids from the scan result at the given index as a
+// comma separated list or "none" if the result is empty.
+func (it *IsolationTest) scanKeyIDs(index int) string {
+	kvs := it.scans[index]
+	if len(kvs) == 0 {
+		return "none"
+	}
+	var ids []string
+	for _, kv := range kvs {
+		for i, k := range it.keys {
+			if k == kv.Key {
+				ids = append(ids, fmt.Sprintf("k%d", i))
+				break
+			}
+		}
+	}
+	return strings.Join(ids, ",")
+}
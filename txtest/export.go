@@ -0,0 +1,583 @@
+package txtest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// historyVersion is the version of the JSON schema for histories.
+const historyVersion = 1
+
+type jsonHistory struct {
+	Version int         `json:"version"`
+	Keys    []string    `json:"keys"`
+	Initial []jsonValue `json:"initial"`
+	Final   []jsonValue `json:"final,omitempty"`
+	Ops     []jsonOp    `json:"ops"`
+}
+
+// jsonOp is an Op with the value encoded as a jsonValue. Value is omitted
+// for the ops other than get and set.
+type jsonOp struct {
+	Op
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// jsonValue is a value of a key, which is encoded as null when the key is
+// missing.
+type jsonValue string
+
+func (v jsonValue) MarshalJSON() ([]byte, error) {
+	if v == "os.ErrNotExist" {
+		return []byte("null"), nil
+	}
+	return json.Marshal(string(v))
+}
+
+func (v *jsonValue) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*v = "os.ErrNotExist"
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*v = jsonValue(s)
+	return nil
+}
+
+// WriteJSON writes the history as a JSON object with "version", "keys",
+// "initial", "final" and "ops" fields. Every op is an object with the fields
+// of the Op type in lower case, where status is one of the names returned by
+// StepStatus.String and times are in RFC 3339 format. Values of missing keys
+// are null. Returns an error if a key or value is not valid UTF-8.
+func (h *History) WriteJSON(w io.Writer) error {
+	if err := h.checkUTF8(); err != nil {
+		return err
+	}
+	jh := &jsonHistory{Version: historyVersion, Keys: h.Keys}
+	for _, v := range h.Initial {
+		jh.Initial = append(jh.Initial, jsonValue(v))
+	}
+	for _, v := range h.Final {
+		jh.Final = append(jh.Final, jsonValue(v))
+	}
+	for _, op := range h.Ops {
+		jop := jsonOp{Op: op}
+		if op.Type == "get" || op.Type == "set" {
+			v, err := jsonValue(op.Value).MarshalJSON()
+			if err != nil {
+				return err
+			}
+			jop.Value = v
+		}
+		jh.Ops = append(jh.Ops, jop)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jh)
+}
+
+// ParseHistoryJSON reads a history in the format written by WriteJSON.
+func ParseHistoryJSON(r io.Reader) (*History, error) {
+	jh := new(jsonHistory)
+	if err := json.NewDecoder(r).Decode(jh); err != nil {
+		return nil, err
+	}
+	if jh.Version != historyVersion {
+		return nil, fmt.Errorf("unsupported history version %d: %w", jh.Version, os.ErrInvalid)
+	}
+	h := &History{Keys: jh.Keys}
+	for _, v := range jh.Initial {
+		h.Initial = append(h.Initial, string(v))
+	}
+	for _, v := range jh.Final {
+		h.Final = append(h.Final, string(v))
+	}
+	for _, jop := range jh.Ops {
+		op := jop.Op
+		if len(jop.Value) > 0 {
+			var v jsonValue
+			if err := v.UnmarshalJSON(jop.Value); err != nil {
+				return nil, err
+			}
+			op.Value = string(v)
+		}
+		h.Ops = append(h.Ops, op)
+	}
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// WriteEDN writes the history in the Jepsen history format, with one op map
+// per line. Every tx is written as a pair of :invoke and completion ops for
+// the :txn function, where the process is the tx-id and the value holds the
+// [:r key value] and [:w key value] micro-operations in the tx order. Missing
+// keys and deletes use nil values, and range reads are written as reads of
+// every key in the range. Committed txes complete with :ok, aborted txes with
+// :fail and txes with an unknown outcome with :info.
+//
+// Initial and final values are written as an :ok tx with the :role :init
+// that writes every key before all other ops, and an :ok tx with the :role
+// :final that reads every key after all other ops. Returns an error if a key
+// or value is not valid UTF-8.
+func (h *History) WriteEDN(w io.Writer) error {
+	if err := h.checkUTF8(); err != nil {
+		return err
+	}
+	type event struct {
+		at  time.Time
+		seq int
+		op  string
+	}
+	var events []event
+	add := func(at time.Time, op string) {
+		events = append(events, event{at, len(events), op})
+	}
+
+	start, end := h.timeRange()
+	ntx := 0
+	for _, t := range h.txes() {
+		if t.tx >= ntx {
+			ntx = t.tx + 1
+		}
+		add(t.invoke, fmt.Sprintf(":type :invoke, :f :txn, :process %d, :value %s", t.tx, t.microOps(true)))
+		add(t.complete, fmt.Sprintf(":type %s, :f :txn, :process %d, :value %s", t.outcome, t.tx, t.microOps(false)))
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].at.Equal(events[j].at) {
+			return events[i].at.Before(events[j].at)
+		}
+		return events[i].seq < events[j].seq
+	})
+
+	var ws, rs []string
+	for i, k := range h.Keys {
+		ws = append(ws, fmt.Sprintf("[:w %s %s]", ednString(k), ednValue(h.Initial[i])))
+		if i < len(h.Final) {
+			rs = append(rs, fmt.Sprintf("[:r %s %s]", ednString(k), ednValue(h.Final[i])))
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	index := 0
+	write := func(at time.Time, op string) {
+		fmt.Fprintf(bw, "{:index %d, :time %d, %s}\n", index, at.Sub(start).Nanoseconds(), op)
+		index++
+	}
+	if len(ws) > 0 {
+		init := fmt.Sprintf(":f :txn, :process %d, :role :init, :value [%s]", ntx, strings.Join(ws, " "))
+		write(start, ":type :invoke, "+init)
+		write(start, ":type :ok, "+init)
+	}
+	for _, e := range events {
+		write(e.at, e.op)
+	}
+	if len(rs) > 0 {
+		final := fmt.Sprintf(":f :txn, :process %d, :role :final", ntx+1)
+		write(end, ":type :invoke, "+final+", :value ["+strings.Join(nilReads(h.Keys[:len(rs)]), " ")+"]")
+		write(end, ":type :ok, "+final+", :value ["+strings.Join(rs, " ")+"]")
+	}
+	return bw.Flush()
+}
+
+// txSummary holds the ops of a tx for the EDN format.
+type txSummary struct {
+	tx       int
+	ops      []Op
+	invoke   time.Time
+	complete time.Time
+	outcome  string
+}
+
+// txes groups the ops by tx in the order of tx ids.
+func (h *History) txes() []*txSummary {
+	m := make(map[int]*txSummary)
+	var ids []int
+	for _, op := range h.Ops {
+		t, ok := m[op.Tx]
+		if !ok {
+			t = &txSummary{tx: op.Tx, invoke: op.Invoke, outcome: ":info"}
+			m[op.Tx] = t
+			ids = append(ids, op.Tx)
+		}
+		t.ops = append(t.ops, op)
+		if op.Complete.After(t.complete) {
+			t.complete = op.Complete
+		}
+		switch {
+		case op.Type == "commit" && op.Status == StepSucceeded:
+			t.outcome = ":ok"
+		case op.Type == "commit" && op.Status == StepFailed, op.Type == "abort":
+			t.outcome = ":fail"
+		}
+	}
+	sort.Ints(ids)
+
+	var txes []*txSummary
+	for _, id := range ids {
+		txes = append(txes, m[id])
+	}
+	return txes
+}
+
+// microOps returns the micro-operations of the tx as an EDN vector. Read
+// values are nil for the invoke ops.
+func (t *txSummary) microOps(invoke bool) string {
+	var mops []string
+	read := func(k, v string) {
+		if invoke {
+			v = "os.ErrNotExist"
+		}
+		mops = append(mops, fmt.Sprintf("[:r %s %s]", ednString(k), ednValue(v)))
+	}
+	for _, op := range t.ops {
+		if op.Status != StepSucceeded {
+			continue
+		}
+		switch op.Type {
+		case "get":
+			read(op.Key, op.Value)
+		case "set":
+			mops = append(mops, fmt.Sprintf("[:w %s %s]", ednString(op.Key), ednString(op.Value)))
+		case "delete":
+			mops = append(mops, fmt.Sprintf("[:w %s nil]", ednString(op.Key)))
+		case "scan", "ascend", "descend":
+			for _, kv := range op.Range {
+				read(kv.Key, kv.Value)
+			}
+		}
+	}
+	return "[" + strings.Join(mops, " ") + "]"
+}
+
+// timeRange returns the earliest invoke time and the latest complete time of
+// the ops.
+func (h *History) timeRange() (start, end time.Time) {
+	for i, op := range h.Ops {
+		if i == 0 || op.Invoke.Before(start) {
+			start = op.Invoke
+		}
+		if op.Complete.After(end) {
+			end = op.Complete
+		}
+	}
+	if end.Before(start) {
+		end = start
+	}
+	return start, end
+}
+
+func nilReads(keys []string) []string {
+	var rs []string
+	for _, k := range keys {
+		rs = append(rs, fmt.Sprintf("[:r %s nil]", ednString(k)))
+	}
+	return rs
+}
+
+// ednValue returns the EDN form of a value, where missing keys are nil.
+func ednValue(v string) string {
+	if v == "os.ErrNotExist" {
+		return "nil"
+	}
+	return ednString(v)
+}
+
+func ednString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&sb, `\u%04x`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// ParseHistoryEDN reads a history in the Jepsen format with :txn ops, e.g.,
+// as written by WriteEDN. Every completed tx is assigned a tx-id in the order
+// of invocation and its micro-operations are converted to get, set and delete
+// ops, followed by a commit op for :ok txes, an abort op for :fail txes and a
+// timed out commit op for :info txes and txes that were never completed.
+// Reads of all txes other than :ok txes are dropped, because their values
+// are unknown.
+//
+// Initial and final values are taken from the txes with :role :init and
+// :role :final, if any. Otherwise, all keys are initially missing and the
+// final values are unknown.
+func ParseHistoryEDN(r io.Reader) (*History, error) {
+	forms, err := parseEDN(r)
+	if err != nil {
+		return nil, err
+	}
+	// A history may also be written as a single vector of ops.
+	if len(forms) == 1 {
+		if v, ok := forms[0].([]interface{}); ok {
+			forms = v
+		}
+	}
+
+	h := new(History)
+	keyIndex := make(map[string]int)
+	addKey := func(k string) int {
+		if i, ok := keyIndex[k]; ok {
+			return i
+		}
+		keyIndex[k] = len(h.Keys)
+		h.Keys = append(h.Keys, k)
+		h.Initial = append(h.Initial, "os.ErrNotExist")
+		return keyIndex[k]
+	}
+
+	type pending struct {
+		tx     int
+		invoke time.Time
+		mops   [][3]string
+	}
+	invoked := make(map[int64]*pending)
+	ntx := 0
+	var final [][2]string
+
+	complete := func(p *pending, typ ednKeyword, mops [][3]string, at time.Time) {
+		status, end := StepSucceeded, "commit"
+		switch typ {
+		case "fail":
+			end = "abort"
+		case "info":
+			status = StepTimedOut
+		}
+		add := func(op Op) {
+			op.Index, op.Line, op.Tx = len(h.Ops), -1, p.tx
+			op.Invoke, op.Complete = p.invoke, at
+			h.Ops = append(h.Ops, op)
+		}
+		for _, mop := range mops {
+			addKey(mop[1])
+			switch {
+			case mop[0] == "r" && typ == "ok":
+				add(Op{Type: "get", Key: mop[1], Value: mop[2], Status: StepSucceeded})
+			case mop[0] == "w" && mop[2] == "os.ErrNotExist":
+				add(Op{Type: "delete", Key: mop[1], Status: StepSucceeded})
+			case mop[0] == "w":
+				add(Op{Type: "set", Key: mop[1], Value: mop[2], Status: StepSucceeded})
+			}
+		}
+		add(Op{Type: end, Status: status})
+	}
+
+	for i, form := range forms {
+		m, ok := form.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("op %d is not a map: %w", i, os.ErrInvalid)
+		}
+		typ, _ := m[ednKeyword("type")].(ednKeyword)
+		f, _ := m[ednKeyword("f")].(ednKeyword)
+		process, pok := m[ednKeyword("process")].(int64)
+		if f != "txn" || !pok {
+			continue // Not a client tx op, e.g., a nemesis op.
+		}
+		at := time.Unix(0, 0).UTC()
+		if t, ok := m[ednKeyword("time")].(int64); ok {
+			at = time.Unix(0, t).UTC()
+		}
+		mops, err := parseMicroOps(m[ednKeyword("value")])
+		if err != nil {
+			return nil, fmt.Errorf("op %d: %w", i, err)
+		}
+
+		role, _ := m[ednKeyword("role")].(ednKeyword)
+		if typ != "invoke" && (role == "init" || role == "final") {
+			for _, mop := range mops {
+				idx := addKey(mop[1])
+				if role == "init" && mop[0] == "w" {
+					h.Initial[idx] = mop[2]
+				}
+				if role == "final" && mop[0] == "r" {
+					final = append(final, [2]string{mop[1], mop[2]})
+				}
+			}
+			continue
+		}
+		if role == "init" || role == "final" {
+			continue
+		}
+
+		if typ == "invoke" {
+			invoked[process] = &pending{tx: ntx, invoke: at, mops: mops}
+			ntx++
+			continue
+		}
+		p, ok := invoked[process]
+		if !ok {
+			return nil, fmt.Errorf("op %d: completion without invocation for process %d: %w", i, process, os.ErrInvalid)
+		}
+		delete(invoked, process)
+		if typ != "ok" && typ != "fail" && typ != "info" {
+			return nil, fmt.Errorf("op %d: unknown op type %q: %w", i, typ, os.ErrInvalid)
+		}
+		complete(p, typ, mops, at)
+	}
+
+	// Txes that were never completed have an unknown outcome.
+	var incomplete []*pending
+	for _, p := range invoked {
+		incomplete = append(incomplete, p)
+	}
+	sort.Slice(incomplete, func(i, j int) bool { return incomplete[i].tx < incomplete[j].tx })
+	for _, p := range incomplete {
+		complete(p, "info", p.mops, p.invoke)
+	}
+
+	if len(final) > 0 {
+		h.Final = append([]string{}, h.Initial...)
+		for _, kv := range final {
+			h.Final[keyIndex[kv[0]]] = kv[1]
+		}
+	}
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// parseMicroOps converts the [:r key value] and [:w key value] micro-operations
+// to (f, key, value) tuples, where nil values are "os.ErrNotExist".
+func parseMicroOps(value interface{}) ([][3]string, error) {
+	vs, ok := value.([]interface{})
+	if !ok && value != nil {
+		return nil, fmt.Errorf("txn value is not a vector: %w", os.ErrInvalid)
+	}
+	var mops [][3]string
+	for _, v := range vs {
+		mop, ok := v.([]interface{})
+		if !ok || len(mop) != 3 {
+			return nil, fmt.Errorf("invalid micro-operation %v: %w", v, os.ErrInvalid)
+		}
+		f, ok := mop[0].(ednKeyword)
+		if !ok || (f != "r" && f != "w") {
+			return nil, fmt.Errorf("unsupported micro-operation %v: %w", mop[0], os.ErrInvalid)
+		}
+		k, err := ednText(mop[1])
+		if err != nil {
+			return nil, err
+		}
+		val := "os.ErrNotExist"
+		if mop[2] != nil {
+			if val, err = ednText(mop[2]); err != nil {
+				return nil, err
+			}
+		}
+		mops = append(mops, [3]string{string(f), k, val})
+	}
+	return mops, nil
+}
+
+// ednText returns the string form of a key or value.
+func ednText(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case int64:
+		return fmt.Sprint(x), nil
+	case ednKeyword:
+		return ":" + string(x), nil
+	}
+	return "", fmt.Errorf("unsupported key or value %v: %w", v, os.ErrInvalid)
+}
+
+// check validates that the key values are consistent with the keys.
+func (h *History) check() error {
+	if len(h.Initial) != len(h.Keys) {
+		return fmt.Errorf("history has %d initial values for %d keys: %w", len(h.Initial), len(h.Keys), os.ErrInvalid)
+	}
+	if len(h.Final) != 0 && len(h.Final) != len(h.Keys) {
+		return fmt.Errorf("history has %d final values for %d keys: %w", len(h.Final), len(h.Keys), os.ErrInvalid)
+	}
+	return nil
+}
+
+// checkUTF8 returns an error if a key or value in the history is not valid
+// UTF-8, because the JSON and EDN strings cannot hold them.
+func (h *History) checkUTF8() error {
+	ss := append(append(append([]string{}, h.Keys...), h.Initial...), h.Final...)
+	for _, op := range h.Ops {
+		ss = append(ss, op.Key, op.End, op.Value)
+		for _, kv := range op.Range {
+			ss = append(ss, kv.Key, kv.Value)
+		}
+	}
+	for _, s := range ss {
+		if !utf8.ValidString(s) {
+			return fmt.Errorf("history has a key or value %q that is not valid UTF-8: %w", s, os.ErrInvalid)
+		}
+	}
+	return nil
+}
+
+// SaveHistory writes the history to the file in the JSON format when the file
+// name has ".json" extension, or in the EDN format otherwise.
+func SaveHistory(file string, h *History) (status error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	if filepath.Ext(file) == ".json" {
+		return h.WriteJSON(f)
+	}
+	return h.WriteEDN(f)
+}
+
+// LoadHistory reads a history from the file in the JSON format when the file
+// name has ".json" extension, or in the EDN format otherwise.
+func LoadHistory(file string) (*History, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var h *History
+	if filepath.Ext(file) == ".json" {
+		h, err = ParseHistoryJSON(f)
+	} else {
+		h, err = ParseHistoryEDN(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return h, nil
+}
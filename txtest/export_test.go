@@ -0,0 +1,95 @@
+package txtest
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exportHistory returns a history with missing keys, deletes, an aborted tx
+// and values that need escaping.
+func exportHistory() *History {
+	h := testHistory([]string{"x1", "os.ErrNotExist"},
+		getOp(0, "x", "x0"), setOp(0, "x", "x1"), commitOp(0),
+		getOp(1, "y", "y0"), Op{Tx: 1, Type: "delete", Key: "y"}, commitOp(1),
+		setOp(2, "x", "quote \" back \\ tab \t line\n é"), abortOp(2),
+		getOp(3, "y", "os.ErrNotExist"), commitOp(3))
+	h.Initial[1] = "y0"
+	return h
+}
+
+func opStrings(h *History) []string {
+	var ss []string
+	for i := range h.Ops {
+		ss = append(ss, h.Ops[i].String())
+	}
+	return ss
+}
+
+func TestHistoryJSON(t *testing.T) {
+	h := exportHistory()
+	var buf bytes.Buffer
+	if err := h.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"value": null`) {
+		t.Errorf("missing key is not encoded as null:\n%s", buf.String())
+	}
+	got, err := ParseHistoryJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("ParseHistoryJSON() = %+v, want %+v", got, h)
+	}
+}
+
+func TestHistoryJSONVersion(t *testing.T) {
+	in := `{"version": 2, "keys": [], "initial": [], "ops": []}`
+	if _, err := ParseHistoryJSON(strings.NewReader(in)); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("ParseHistoryJSON() error = %v, want %v", err, os.ErrInvalid)
+	}
+}
+
+func TestHistoryEDN(t *testing.T) {
+	h := exportHistory()
+	var buf bytes.Buffer
+	if err := h.WriteEDN(&buf); err != nil {
+		t.Fatal(err)
+	}
+	edn := buf.String()
+	got, err := ParseHistoryEDN(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Keys, h.Keys) || !reflect.DeepEqual(got.Initial, h.Initial) || !reflect.DeepEqual(got.Final, h.Final) {
+		t.Errorf("ParseHistoryEDN() has keys %q = %q => %q, want %q = %q => %q", got.Keys, got.Initial, got.Final, h.Keys, h.Initial, h.Final)
+	}
+	if g, w := opStrings(got), opStrings(h); !reflect.DeepEqual(g, w) {
+		t.Errorf("ParseHistoryEDN() has ops\n%s\nwant\n%s", strings.Join(g, "\n"), strings.Join(w, "\n"))
+	}
+
+	// Parsed history is written in the same form.
+	buf.Reset()
+	if err := got.WriteEDN(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != edn {
+		t.Errorf("WriteEDN() after ParseHistoryEDN() =\n%s\nwant\n%s", buf.String(), edn)
+	}
+}
+
+func TestHistoryInvalidUTF8(t *testing.T) {
+	h := exportHistory()
+	h.Ops[1].Value = "x\xff"
+	var buf bytes.Buffer
+	if err := h.WriteJSON(&buf); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("WriteJSON() error = %v, want %v", err, os.ErrInvalid)
+	}
+	if err := h.WriteEDN(&buf); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("WriteEDN() error = %v, want %v", err, os.ErrInvalid)
+	}
+}
@@ -0,0 +1,98 @@
+package txtest
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+// WorkloadOptions controls the steps generated by GenerateSteps.
+type WorkloadOptions struct {
+	// NumTx is the number of txes. Defaults to 3.
+	NumTx int
+
+	// NumKeys is the maximum number of keys used by the steps. Defaults to 3.
+	NumKeys int
+
+	// NumOps is the number of get, set and delete operations in every tx.
+	// Defaults to 3.
+	NumOps int
+
+	// GetWeight, SetWeight and DeleteWeight are the relative frequencies of
+	// the get, set and delete operations. All of them default to 1 when they
+	// are all zero.
+	GetWeight    int
+	SetWeight    int
+	DeleteWeight int
+
+	// AbortRatio is the probability for a tx to end with an abort instead of a
+	// commit.
+	AbortRatio float64
+}
+
+func (w *WorkloadOptions) setDefaults() {
+	if w.NumTx <= 0 {
+		w.NumTx = 3
+	}
+	if w.NumKeys <= 0 {
+		w.NumKeys = 3
+	}
+	if w.NumOps <= 0 {
+		w.NumOps = 3
+	}
+	if w.GetWeight == 0 && w.SetWeight == 0 && w.DeleteWeight == 0 {
+		w.GetWeight, w.SetWeight, w.DeleteWeight = 1, 1, 1
+	}
+}
+
+// GenerateSteps returns a random, but valid, test with the operations of all
+// txes randomly interleaved. Every value written by the steps is unique.
+func GenerateSteps(r *rand.Rand, opts *WorkloadOptions) ([]string, error) {
+	var w WorkloadOptions
+	if opts != nil {
+		w = *opts
+	}
+	w.setDefaults()
+	if w.GetWeight < 0 || w.SetWeight < 0 || w.DeleteWeight < 0 {
+		return nil, fmt.Errorf("operation weights cannot be negative: %w", os.ErrInvalid)
+	}
+
+	// Key ids are renumbered in the order of their first use, because key ids
+	// in a test must be contiguous.
+	keyids := make(map[int]int)
+	keyid := func(k int) int {
+		if id, ok := keyids[k]; ok {
+			return id
+		}
+		keyids[k] = len(keyids)
+		return keyids[k]
+	}
+
+	programs := make([][]string, w.NumTx)
+	total := w.GetWeight + w.SetWeight + w.DeleteWeight
+	for tx := range programs {
+		programs[tx] = append(programs[tx], fmt.Sprintf("t%d: begin", tx))
+		for op := 0; op < w.NumOps; op++ {
+			k := keyid(r.Intn(w.NumKeys))
+			switch x := r.Intn(total); {
+			case x < w.GetWeight:
+				programs[tx] = append(programs[tx], fmt.Sprintf("t%d: get-k%d", tx, k))
+			case x < w.GetWeight+w.SetWeight:
+				programs[tx] = append(programs[tx], fmt.Sprintf("t%d: set-k%d-t%dv%d", tx, k, tx, op))
+			default:
+				programs[tx] = append(programs[tx], fmt.Sprintf("t%d: delete-k%d", tx, k))
+			}
+		}
+		if r.Float64() < w.AbortRatio {
+			programs[tx] = append(programs[tx], fmt.Sprintf("t%d: abort", tx))
+		} else {
+			programs[tx] = append(programs[tx], fmt.Sprintf("t%d: commit", tx))
+		}
+	}
+
+	steps := randomInterleaving(programs, r)
+	if _, _, err := ParseSteps(steps); err != nil {
+		return nil, fmt.Errorf("generated steps are invalid: %w", err)
+	}
+	return steps, nil
+}
@@ -0,0 +1,121 @@
+package txtest
+
+import (
+	"fmt"
+	"time"
+)
+
+// Op is a single operation in a history.
+type Op struct {
+	// Index is the position of the operation in the history and Line is the
+	// index of its step.
+	Index int `json:"index"`
+	Line  int `json:"line"`
+
+	// Tx is the tx-id of the operation and Type is the name of the operation,
+	// e.g., "get", "set" or "commit".
+	Tx   int    `json:"tx"`
+	Type string `json:"type"`
+
+	// Key is the key used by get, set and delete operations and End is the
+	// end of the range for ascend and descend operations, which use Key as the
+	// beginning of the range.
+	Key string `json:"key,omitempty"`
+	End string `json:"end,omitempty"`
+
+	// Value is the value written by a set operation or read by a get
+	// operation. Missing keys are read as "os.ErrNotExist", which is encoded
+	// as null in JSON and nil in EDN.
+	Value string `json:"value,omitempty"`
+
+	// Range holds the key-value pairs read by a scan, ascend or descend
+	// operation.
+	Range []KeyValue `json:"range,omitempty"`
+
+	// Invoke and Complete hold the times when the operation was started and
+	// when it has returned or was abandoned.
+	Invoke   time.Time `json:"invoke"`
+	Complete time.Time `json:"complete"`
+
+	// Status is the outcome of the operation and Err is the error message
+	// for failed operations.
+	Status StepStatus `json:"status"`
+	Err    string     `json:"error,omitempty"`
+}
+
+func (op *Op) String() string {
+	s := fmt.Sprintf("t%d: %s", op.Tx, op.Type)
+	switch op.Type {
+	case "get", "set":
+		s += fmt.Sprintf(" %s=%s", op.Key, QuoteValue(op.Value))
+	case "delete":
+		s += " " + op.Key
+	case "ascend", "descend":
+		s += fmt.Sprintf(" [%s,%s] => %v", op.Key, op.End, op.Range)
+	case "scan":
+		s += fmt.Sprintf(" => %v", op.Range)
+	}
+	if op.Status != StepSucceeded {
+		s += fmt.Sprintf(" (%s)", op.Status)
+	}
+	return s
+}
+
+// History holds the operations performed by a test run along with the
+// initial and final values of the keys.
+type History struct {
+	// Keys holds the keys used by the run. Initial and Final hold the values
+	// of the keys before and after the run, in the same order. Final values
+	// may be missing for histories loaded from other tools. Histories with
+	// keys or values that are not valid UTF-8 cannot be written in the JSON
+	// and EDN formats.
+	Keys    []string `json:"keys"`
+	Initial []string `json:"initial"`
+	Final   []string `json:"final,omitempty"`
+
+	// Ops holds the operations in the order of completion.
+	Ops []Op `json:"ops"`
+}
+
+// History returns the history of operations from the most recent run.
+func (it *IsolationTest) History() *History {
+	h := &History{
+		Keys:  append([]string{}, it.keys...),
+		Final: append([]string{}, it.values...),
+		Ops:   append([]Op{}, it.history...),
+	}
+	// Keys are initialized to themselves before every run.
+	h.Initial = append([]string{}, it.keys...)
+	return h
+}
+
+// newOp returns the history entry for a step.
+func newOp(index, line int, ps *parsedStep, res stepResult, status StepStatus, keys []string) Op {
+	op := Op{
+		Index:    index,
+		Line:     line,
+		Tx:       ps.tx,
+		Type:     opName(ps.re),
+		Invoke:   res.invoke,
+		Complete: res.complete,
+		Status:   status,
+	}
+	if res.err != nil {
+		op.Err = res.err.Error()
+	}
+
+	switch ps.re {
+	case GetRe:
+		op.Key, op.Value = keys[ps.key], res.get
+	case SetRe:
+		op.Key, op.Value = keys[ps.key], ps.value
+	case DeleteRe:
+		op.Key = keys[ps.key]
+	case AscendRe, DescendRe:
+		op.Key, op.End = keys[ps.key], keys[ps.end]
+		op.Range = res.scan
+	case ScanRe:
+		op.Range = res.scan
+	}
+	return op
+}
@@ -0,0 +1,282 @@
+package txtest
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bvkgo/kv"
+)
+
+// Programs splits the steps into per-tx programs, which hold the steps for
+// each tx in the original order. Expected results are removed from the steps,
+// because they only hold for the original order, and lines that do not belong
+// to any tx are dropped. See FinalSteps for the final values.
+func Programs(steps []string) ([][]string, error) {
+	ntx, _, err := ParseSteps(steps)
+	if err != nil {
+		return nil, err
+	}
+	programs := make([][]string, ntx)
+	for i := range programs {
+		programs[i] = stripExpectations(FilterSteps(steps, i))
+	}
+	return programs, nil
+}
+
+// FinalSteps returns the lines that describe the expected final values.
+func FinalSteps(steps []string) []string {
+	var finals []string
+	for _, step := range steps {
+		if FinalRe.MatchString(step) {
+			finals = append(finals, step)
+		}
+	}
+	return finals
+}
+
+// stripExpectations returns the steps without their expected results.
+func stripExpectations(steps []string) []string {
+	stripped := make([]string, 0, len(steps))
+	for _, step := range steps {
+		op, _, _ := cutExpect(step)
+		stripped = append(stripped, strings.TrimSpace(op))
+	}
+	return stripped
+}
+
+// NumInterleavings returns the number of interleavings of the programs that
+// preserve the order of steps within each program.
+func NumInterleavings(programs [][]string) *big.Int {
+	// Multinomial coefficient (n1+n2+...+nk)! / (n1! * n2! * ... * nk!) is
+	// computed as a product of binomial coefficients.
+	total, n := big.NewInt(1), 0
+	for _, p := range programs {
+		n += len(p)
+		total.Mul(total, new(big.Int).Binomial(int64(n), int64(len(p))))
+	}
+	return total
+}
+
+// forEachInterleaving invokes the callback with every interleaving of the
+// programs that preserves the order of steps within each program.
+func forEachInterleaving(programs [][]string, fn func([]string) error) error {
+	n := 0
+	for _, p := range programs {
+		n += len(p)
+	}
+	next := make([]int, len(programs))
+	steps := make([]string, 0, n)
+
+	var visit func() error
+	visit = func() error {
+		if len(steps) == n {
+			return fn(append([]string{}, steps...))
+		}
+		for i, p := range programs {
+			if next[i] == len(p) {
+				continue
+			}
+			steps = append(steps, p[next[i]])
+			next[i]++
+			if err := visit(); err != nil {
+				return err
+			}
+			next[i]--
+			steps = steps[:len(steps)-1]
+		}
+		return nil
+	}
+	return visit()
+}
+
+// randomInterleaving returns an interleaving of the programs chosen uniformly
+// at random from all interleavings that preserve the order of steps within
+// each program.
+func randomInterleaving(programs [][]string, r *rand.Rand) []string {
+	n := 0
+	for _, p := range programs {
+		n += len(p)
+	}
+	next := make([]int, len(programs))
+	steps := make([]string, 0, n)
+	for remaining := n; remaining > 0; remaining-- {
+		// Picking a program with probability proportional to the number of its
+		// remaining steps makes every interleaving equally likely.
+		x := r.Intn(remaining)
+		for i, p := range programs {
+			if x < len(p)-next[i] {
+				steps = append(steps, p[next[i]])
+				next[i]++
+				break
+			}
+			x -= len(p) - next[i]
+		}
+	}
+	return steps
+}
+
+// ExploreOptions controls the interleavings run by Explore.
+type ExploreOptions struct {
+	// MaxInterleavings is the maximum number of interleavings to run. When
+	// there are more interleavings, a random sample of this size is run.
+	// Defaults to 1000.
+	MaxInterleavings int
+
+	// Seed initializes the random number generator used for sampling.
+	Seed int64
+
+	// Concurrent enables the concurrent mode with the BlockWait duration for
+	// every interleaving. See IsolationTest.SetConcurrent.
+	Concurrent bool
+	BlockWait  time.Duration
+
+	// Finals holds the expected final values, which are checked after every
+	// successful run. See FinalSteps.
+	Finals []string
+
+	// Check is invoked after every successful run to validate the outcome, in
+	// addition to the final values.
+	Check func(context.Context, *IsolationTest) error
+}
+
+// Exploration holds the aggregated outcome of running many interleavings.
+type Exploration struct {
+	// Total is the number of all possible interleavings.
+	Total *big.Int
+
+	// Sampled is true if only a random sample of the interleavings was run.
+	Sampled bool
+
+	// Runs is the number of interleavings that were run.
+	Runs int
+
+	// Outcomes maps a description of the tx commit statuses and final values
+	// to the number of interleavings with that outcome.
+	Outcomes map[string]int
+
+	// Failures holds the interleavings that failed to run or check.
+	Failures []*ExploreFailure
+}
+
+// ExploreFailure holds an interleaving and the error it failed with.
+type ExploreFailure struct {
+	Steps []string
+	Err   error
+}
+
+func (f *ExploreFailure) Error() string {
+	return fmt.Sprintf("%v (steps %q)", f.Err, f.Steps)
+}
+
+// Explore runs interleavings of the per-tx programs against the backend,
+// using the keys in place of the key ids. Every interleaving that preserves
+// the order of steps within each program is run, unless there are more than
+// MaxInterleavings of them, in which case a random sample of distinct
+// interleavings is run instead. Expected results in the program steps are
+// ignored, because they only hold for the original order of the steps.
+func Explore(ctx context.Context, newTx kv.NewTxFunc, newIt kv.NewIterFunc, keys []string, programs [][]string, opts *ExploreOptions) (*Exploration, error) {
+	if len(programs) == 0 {
+		return nil, fmt.Errorf("at least one program is required: %w", os.ErrInvalid)
+	}
+	var eopts ExploreOptions
+	if opts != nil {
+		eopts = *opts
+	}
+	if eopts.MaxInterleavings <= 0 {
+		eopts.MaxInterleavings = 1000
+	}
+
+	for _, final := range eopts.Finals {
+		if !FinalRe.MatchString(final) {
+			return nil, fmt.Errorf("invalid final value line %q: %w", final, os.ErrInvalid)
+		}
+	}
+	stripped := make([][]string, len(programs))
+	for i, p := range programs {
+		stripped[i] = stripExpectations(p)
+	}
+	programs = stripped
+
+	e := &Exploration{
+		Total:    NumInterleavings(programs),
+		Outcomes: make(map[string]int),
+	}
+	run := func(steps []string) error {
+		e.Runs++
+		it, err := NewIsolationTest(append(steps, eopts.Finals...))
+		if err != nil {
+			return err
+		}
+		if eopts.Concurrent {
+			it.SetConcurrent(eopts.BlockWait)
+		}
+		if _, err := it.Run(ctx, newTx, newIt, keys); err != nil {
+			e.Failures = append(e.Failures, &ExploreFailure{Steps: steps, Err: err})
+			return nil
+		}
+		e.Outcomes[it.outcome()]++
+		if err := it.CheckExpectations(); err != nil {
+			e.Failures = append(e.Failures, &ExploreFailure{Steps: steps, Err: err})
+			return nil
+		}
+		if eopts.Check != nil {
+			if err := eopts.Check(ctx, it); err != nil {
+				e.Failures = append(e.Failures, &ExploreFailure{Steps: steps, Err: err})
+			}
+		}
+		return nil
+	}
+
+	if e.Total.Cmp(big.NewInt(int64(eopts.MaxInterleavings))) <= 0 {
+		if err := forEachInterleaving(programs, run); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	e.Sampled = true
+	r := rand.New(rand.NewSource(eopts.Seed))
+	seen := make(map[string]struct{})
+	for attempts := 0; len(seen) < eopts.MaxInterleavings && attempts < 10*eopts.MaxInterleavings; attempts++ {
+		steps := randomInterleaving(programs, r)
+		key := strings.Join(steps, "\n")
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		if err := run(steps); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// outcome returns a description of the tx commit statuses and the final
+// values from the most recent run.
+func (it *IsolationTest) outcome() string {
+	committed := it.committed()
+	var statuses []string
+	for tx := 0; tx < it.ntx; tx++ {
+		switch {
+		case committed[tx]:
+			statuses = append(statuses, fmt.Sprintf("t%d=ok", tx))
+		case it.results[tx] != nil:
+			statuses = append(statuses, fmt.Sprintf("t%d=%s", tx, it.commitResult(tx)))
+		default:
+			statuses = append(statuses, fmt.Sprintf("t%d=abort", tx))
+		}
+	}
+	var values []string
+	for i, v := range it.values {
+		if v == it.keys[i] {
+			v = "initial"
+		}
+		values = append(values, fmt.Sprintf("k%d=%s", i, v))
+	}
+	return strings.Join(statuses, " ") + " " + strings.Join(values, " ")
+}
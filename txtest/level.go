@@ -0,0 +1,46 @@
+package txtest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// IsolationLevel identifies the isolation guarantees of a key-value store.
+// Levels are ordered from the weakest to the strongest. Zero value is
+// IsolationUnspecified, which is not a valid level for a store.
+type IsolationLevel int
+
+const (
+	IsolationUnspecified IsolationLevel = iota
+	ReadUncommitted
+	ReadCommitted
+	SnapshotIsolation
+	Serializable
+)
+
+var levelNames = []string{
+	IsolationUnspecified: "unspecified",
+	ReadUncommitted:      "read-uncommitted",
+	ReadCommitted:        "read-committed",
+	SnapshotIsolation:    "snapshot-isolation",
+	Serializable:         "serializable",
+}
+
+func (l IsolationLevel) String() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return fmt.Sprintf("IsolationLevel(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseIsolationLevel returns the isolation level for the given name, which
+// must be one of the names returned by IsolationLevel.String.
+func ParseIsolationLevel(s string) (IsolationLevel, error) {
+	for i, name := range levelNames {
+		if IsolationLevel(i) != IsolationUnspecified && strings.EqualFold(s, name) {
+			return IsolationLevel(i), nil
+		}
+	}
+	return -1, fmt.Errorf("unknown isolation level %q: %w", s, os.ErrInvalid)
+}
@@ -0,0 +1,139 @@
+package txtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Scenario holds the steps for an isolation test loaded from a file.
+type Scenario struct {
+	// Name of the scenario. Defaults to the file name without the extension.
+	Name string
+
+	// Isolation is the weakest isolation level for which the scenario is
+	// expected to pass. Defaults to Serializable.
+	Isolation IsolationLevel
+
+	// Steps holds the test steps in the order they appear.
+	Steps []string
+}
+
+// ParseScenario reads a scenario with one step per line. Empty lines and lines
+// starting with '#' are ignored. Optional header lines of the form "name:
+// <name>" and "isolation: <level>" may appear before the first step.
+//
+// For example:
+//
+//	# Two txes update the same key.
+//	name: lost-update
+//	isolation: snapshot-isolation
+//
+//	t0: begin
+//	t1: begin
+//	t0: get-k0 => initial
+//	t1: get-k0 => initial
+//	t0: set-k0-t0
+//	t1: set-k0-t1
+//	t0: commit => ok
+//	t1: commit => conflict
+//	final: k0 = t0
+func ParseScenario(r io.Reader) (*Scenario, error) {
+	s := &Scenario{Isolation: Serializable}
+
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if name := strings.TrimPrefix(line, "name:"); name != line {
+			if len(s.Steps) > 0 {
+				return nil, fmt.Errorf("line %d: header must appear before the steps: %w", lineno, os.ErrInvalid)
+			}
+			s.Name = strings.TrimSpace(name)
+			continue
+		}
+		if level := strings.TrimPrefix(line, "isolation:"); level != line {
+			if len(s.Steps) > 0 {
+				return nil, fmt.Errorf("line %d: header must appear before the steps: %w", lineno, os.ErrInvalid)
+			}
+			v, err := ParseIsolationLevel(strings.TrimSpace(level))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineno, err)
+			}
+			s.Isolation = v
+			continue
+		}
+
+		if _, err := parseStep(line); err != nil {
+			return nil, fmt.Errorf("line %d: could not parse %q: %w", lineno, line, err)
+		}
+		s.Steps = append(s.Steps, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, _, err := ParseSteps(s.Steps); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadScenario reads a scenario from the file.
+func LoadScenario(file string) (*Scenario, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s, err := ParseScenario(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(s.Name) == 0 {
+		s.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	return s, nil
+}
+
+// LoadScenarios reads all scenarios from the files with ".txn" extension in
+// the directory. Scenarios are returned in the sorted order of file names.
+func LoadScenarios(dir string) ([]*Scenario, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txn"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var ss []*Scenario
+	for _, file := range files {
+		s, err := LoadScenario(file)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+// FormatScenario returns the scenario in the format accepted by
+// ParseScenario.
+func FormatScenario(s *Scenario) string {
+	var sb strings.Builder
+	if len(s.Name) > 0 {
+		fmt.Fprintf(&sb, "name: %s\n", s.Name)
+	}
+	fmt.Fprintf(&sb, "isolation: %s\n\n", s.Isolation)
+	for _, step := range s.Steps {
+		fmt.Fprintln(&sb, step)
+	}
+	return sb.String()
+}
@@ -14,100 +14,202 @@ var (
 	CommitRe = regexp.MustCompile(`^t(\d+): commit$`)
 
 	GetRe    = regexp.MustCompile(`^t(\d+): get-k(\d+)$`)
-	SetRe    = regexp.MustCompile(`^t(\d+): set-k(\d+)-(\w+)$`)
+	SetRe    = regexp.MustCompile(`^t(\d+): set-k(\d+)-(\w+|` + quotedValue + `)$`)
 	DeleteRe = regexp.MustCompile(`^t(\d+): delete-k(\d+)$`)
 
-	// TODO: Add support for ascend/descend/scan operations.
+	ScanRe    = regexp.MustCompile(`^t(\d+): scan$`)
+	AscendRe  = regexp.MustCompile(`^t(\d+): ascend-k(\d+)-k(\d+)$`)
+	DescendRe = regexp.MustCompile(`^t(\d+): descend-k(\d+)-k(\d+)$`)
+
+	// FinalRe matches the lines that describe the expected final value of a
+	// key after all steps are executed. These lines do not belong to any tx.
+	FinalRe = regexp.MustCompile(`^final: k(\d+) = (\S.*)$`)
 )
 
-// ParseStep parses a line in the Test and returns the tx-id, key-id and
-// value.
-func parseStep(step string) (*regexp.Regexp, int, int, string, error) {
-	if BeginRe.MatchString(step) {
-		ms := BeginRe.FindStringSubmatch(step)
-		tx, err := strconv.Atoi(ms[1])
+// ExpectSep separates an operation from its expected result in a step. For
+// example, "t1: get-k0 => t0" expects the get operation to return "t0" and
+// "t1: commit => ok|conflict" accepts both outcomes for the commit.
+//
+// Get operations and final values are compared with the value; the special
+// value "initial" matches the value a key holds before the steps are run.
+// Values with other than word characters are written as quoted strings in
+// the Go syntax (see QuoteValue), e.g., `t1: get-k0 => ""|"a b"`, which is
+// also accepted by the set operations.
+// Scan, ascend and descend operations are compared with a comma separated
+// list of key-ids (e.g., "k0,k2") or "none" for an empty result. Commit
+// operations are compared with "ok", "conflict" or "error", where "error" is
+// a commit that has timed out or failed because of the context or an invalid
+// use of the tx.
+const ExpectSep = " => "
+
+// parsedStep holds the parsed form of a line in the Test. Key ids that are not
+// used by the operation are set to -1.
+type parsedStep struct {
+	re *regexp.Regexp
+
+	tx int
+
+	// key is the key-id for get, set and delete operations and the first
+	// range key-id for ascend and descend operations.
+	key int
+
+	// end is the second range key-id for ascend and descend operations.
+	end int
+
+	value string
+
+	// expect holds the acceptable results for the step, if any.
+	expect []string
+}
+
+// keyIDs returns all key-ids referenced by the step. Every key-id inside the
+// range of ascend and descend operations is referenced.
+func (ps *parsedStep) keyIDs() []int {
+	if ps.key < 0 {
+		return nil
+	}
+	if ps.end < 0 {
+		return []int{ps.key}
+	}
+	lo, hi := ps.key, ps.end
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	var ids []int
+	for i := lo; i <= hi; i++ {
+		ids = append(ids, i)
+	}
+	return ids
+}
+
+// parseStep parses a line in the Test and returns the tx-id, key-ids, value
+// and the expected results.
+func parseStep(step string) (*parsedStep, error) {
+	if ms := FinalRe.FindStringSubmatch(step); ms != nil {
+		key, err := strconv.Atoi(ms[1])
 		if err != nil {
-			return nil, -1, -1, "", err
+			return nil, err
 		}
-		return BeginRe, tx, -1, "", nil
-	}
-	if AbortRe.MatchString(step) {
-		ms := AbortRe.FindStringSubmatch(step)
-		tx, err := strconv.Atoi(ms[1])
+		expect, err := splitValues(ms[2])
 		if err != nil {
-			return nil, -1, -1, "", err
+			return nil, err
 		}
-		return AbortRe, tx, -1, "", nil
+		return &parsedStep{re: FinalRe, tx: -1, key: key, end: -1, expect: expect}, nil
 	}
-	if CommitRe.MatchString(step) {
-		ms := CommitRe.FindStringSubmatch(step)
-		tx, err := strconv.Atoi(ms[1])
+
+	var expect []string
+	op, results, found := cutExpect(step)
+	if found {
+		vs, err := splitValues(strings.TrimSpace(results))
 		if err != nil {
-			return nil, -1, -1, "", err
+			return nil, err
 		}
-		return CommitRe, tx, -1, "", nil
+		expect = vs
 	}
-	if GetRe.MatchString(step) {
-		ms := GetRe.FindStringSubmatch(step)
-		tx, err := strconv.Atoi(ms[1])
-		if err != nil {
-			return nil, -1, -1, "", err
+	ps, err := parseOperation(op)
+	if err != nil {
+		return nil, err
+	}
+	if expect != nil {
+		switch ps.re {
+		case GetRe, CommitRe, ScanRe, AscendRe, DescendRe:
+		default:
+			return nil, fmt.Errorf("expected results are not supported for %q: %w", op, os.ErrInvalid)
 		}
-		key, err := strconv.Atoi(ms[2])
-		if err != nil {
-			return nil, -1, -1, "", err
+		for _, e := range expect {
+			if ps.re == CommitRe && e != "ok" && e != "conflict" && e != "error" {
+				return nil, fmt.Errorf("commit can only expect ok, conflict or error: %w", os.ErrInvalid)
+			}
 		}
-		return GetRe, tx, key, "", nil
+		ps.expect = expect
 	}
-	if SetRe.MatchString(step) {
-		ms := SetRe.FindStringSubmatch(step)
-		tx, err := strconv.Atoi(ms[1])
-		if err != nil {
-			return nil, -1, -1, "", err
-		}
-		key, err := strconv.Atoi(ms[2])
-		if err != nil {
-			return nil, -1, -1, "", err
+	return ps, nil
+}
+
+// parseOperation parses the operation part of a line in the Test.
+func parseOperation(step string) (*parsedStep, error) {
+	for _, re := range []*regexp.Regexp{BeginRe, AbortRe, CommitRe, ScanRe} {
+		if ms := re.FindStringSubmatch(step); ms != nil {
+			tx, err := strconv.Atoi(ms[1])
+			if err != nil {
+				return nil, err
+			}
+			return &parsedStep{re: re, tx: tx, key: -1, end: -1}, nil
 		}
-		return SetRe, tx, key, ms[3], nil
 	}
-	if DeleteRe.MatchString(step) {
-		ms := DeleteRe.FindStringSubmatch(step)
-		tx, err := strconv.Atoi(ms[1])
-		if err != nil {
-			return nil, -1, -1, "", err
+	for _, re := range []*regexp.Regexp{GetRe, SetRe, DeleteRe} {
+		if ms := re.FindStringSubmatch(step); ms != nil {
+			tx, err := strconv.Atoi(ms[1])
+			if err != nil {
+				return nil, err
+			}
+			key, err := strconv.Atoi(ms[2])
+			if err != nil {
+				return nil, err
+			}
+			ps := &parsedStep{re: re, tx: tx, key: key, end: -1}
+			if re == SetRe {
+				if ps.value, err = unquoteValue(ms[3]); err != nil {
+					return nil, err
+				}
+			}
+			return ps, nil
 		}
-		key, err := strconv.Atoi(ms[2])
-		if err != nil {
-			return nil, -1, -1, "", err
+	}
+	for _, re := range []*regexp.Regexp{AscendRe, DescendRe} {
+		if ms := re.FindStringSubmatch(step); ms != nil {
+			tx, err := strconv.Atoi(ms[1])
+			if err != nil {
+				return nil, err
+			}
+			key, err := strconv.Atoi(ms[2])
+			if err != nil {
+				return nil, err
+			}
+			end, err := strconv.Atoi(ms[3])
+			if err != nil {
+				return nil, err
+			}
+			return &parsedStep{re: re, tx: tx, key: key, end: end}, nil
 		}
-		return DeleteRe, tx, key, "", nil
 	}
-	return nil, -1, -1, "", os.ErrInvalid
+	return nil, os.ErrInvalid
 }
 
 // ParseSteps validates the steps and returns number of total txes and keys
-// used by the steps.
+// used by the steps. Number of keys includes the largest range key-id.
 func ParseSteps(steps []string) (int, int, error) {
 	txids := make(map[int]int)
 	keyids := make(map[int]int)
+	nkey, npoint := 0, 0
 
 	begins := make(map[int][]int)
 	aborts := make(map[int][]int)
 	commits := make(map[int][]int)
 
 	for line, step := range steps {
-		re, tx, key, _, err := parseStep(step)
+		ps, err := parseStep(step)
 		if err != nil {
 			return -1, -1, fmt.Errorf("could not parse %q on line %d: %w", step, line, err)
 		}
 
-		txids[tx]++
-		if key >= 0 {
+		for _, key := range ps.keyIDs() {
 			keyids[key]++
+			if key >= nkey {
+				nkey = key + 1
+			}
+			if ps.end < 0 && key >= npoint {
+				npoint = key + 1
+			}
+		}
+		if ps.re == FinalRe {
+			continue
 		}
 
-		switch re {
+		tx := ps.tx
+		txids[tx]++
+
+		switch ps.re {
 		case BeginRe:
 			begins[tx] = append(begins[tx], line)
 		case CommitRe:
@@ -118,13 +220,15 @@ func ParseSteps(steps []string) (int, int, error) {
 	}
 
 	// There should not be gaps in the txids or keyids. For example, we can't
-	// have T1 and T5 without also T2, T3 and T4. Same applies to the key ids.
+	// have T1 and T5 without also T2, T3 and T4. Same applies to the key ids
+	// up to the largest key-id of get, set and delete operations, where the
+	// key-ids inside a range are also used.
 	for i := 0; i < len(txids); i++ {
 		if _, ok := txids[i]; !ok {
 			return -1, -1, fmt.Errorf("tx ids must be contiguous (tx%d is missing): %w", i, os.ErrInvalid)
 		}
 	}
-	for i := 0; i < len(keyids); i++ {
+	for i := 0; i < npoint; i++ {
 		if _, ok := keyids[i]; !ok {
 			return -1, -1, fmt.Errorf("key ids must be contiguous (key%d is missing): %w", i, os.ErrInvalid)
 		}
@@ -151,12 +255,12 @@ func ParseSteps(steps []string) (int, int, error) {
 		}
 	}
 
-	return len(txids), len(keyids), nil
+	return len(txids), nkey, nil
 }
 
 // FilterSteps returns steps that correspond to the given txid.
 func FilterSteps(steps []string, txid int) []string {
-	prefix := fmt.Sprintf("tx%d", txid)
+	prefix := fmt.Sprintf("t%d:", txid)
 	var txsteps []string
 	for _, step := range steps {
 		if strings.HasPrefix(step, prefix) {
@@ -1,6 +1,10 @@
 package txtest
 
-import "sort"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 // permutations returns all permutations of slice with integers [0...n).
 func permutations(n int) [][]int {
@@ -11,15 +15,13 @@ func permutations(n int) [][]int {
 		return [][]int{{0}}
 	}
 	var result [][]int
-	for i := 1; i < n; i++ {
-		for _, perm := range permutations(n - 1) {
-			for j := 0; j < len(perm)+1; j++ {
-				newperm := make([]int, len(perm)+1)
-				copy(newperm, perm[0:j])
-				newperm[j] = i
-				copy(newperm[j+1:], perm[j:])
-				result = append(result, newperm)
-			}
+	for _, perm := range permutations(n - 1) {
+		for j := 0; j < len(perm)+1; j++ {
+			newperm := make([]int, len(perm)+1)
+			copy(newperm, perm[0:j])
+			newperm[j] = n - 1
+			copy(newperm[j+1:], perm[j:])
+			result = append(result, newperm)
 		}
 	}
 	return result
@@ -48,18 +50,28 @@ func SerializedPermutations(steps []string) ([][]string, error) {
 		return nil, err
 	}
 
-	txMap := make(map[int][]string)
-	for i := 0; i < ntx; i++ {
-		txMap[i] = FilterSteps(steps, i)
-	}
-
 	var serializedPerms [][]string
 	for _, perm := range sortedPermutations(ntx) {
-		var serialized []string
-		for _, tx := range perm {
-			serialized = append(serialized, txMap[tx]...)
-		}
+		serialized, _ := serialize(steps, perm)
 		serializedPerms = append(serializedPerms, serialized)
 	}
 	return serializedPerms, nil
 }
+
+// serialize returns the steps of all txes one tx after the other in the order
+// given by perm. It also returns the original step index for every serialized
+// step.
+func serialize(steps []string, perm []int) ([]string, []int) {
+	var serialized []string
+	var lines []int
+	for _, tx := range perm {
+		prefix := fmt.Sprintf("t%d:", tx)
+		for line, step := range steps {
+			if strings.HasPrefix(step, prefix) {
+				serialized = append(serialized, step)
+				lines = append(lines, line)
+			}
+		}
+	}
+	return serialized, lines
+}
@@ -0,0 +1,541 @@
+package txtest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Phenomenon describes an isolation anomaly found in a history, using the
+// names from Adya's "Weak Consistency" thesis:
+//
+//   - G0 is a cycle of write-write dependencies (dirty write).
+//   - G1a is a committed tx reading a value written by an aborted tx.
+//   - G1b is a committed tx reading a value that was overwritten by the same
+//     tx that wrote it (intermediate read).
+//   - G1c is a cycle of write-write and write-read dependencies.
+//   - G-single is a cycle of dependencies with exactly one read-write
+//     anti-dependency (read skew).
+//   - G2-item is a cycle of dependencies with at least one read-write
+//     anti-dependency. Cycles reported as G-single are also reported as
+//     G2-item, because G2-item includes G-single.
+type Phenomenon struct {
+	Name string
+
+	// Txes holds the txes involved in the anomaly. For cycles, txes are in
+	// the cycle order.
+	Txes []int
+
+	// Desc describes the anomaly, e.g., the edges of the cycle.
+	Desc string
+}
+
+func (p *Phenomenon) String() string {
+	return p.Name + ": " + p.Desc
+}
+
+// Proscribes returns true if the isolation level does not allow the
+// phenomenon with the given name. Snapshot isolation proscribes G-single,
+// but allows other G2-item cycles (e.g., write skew).
+func (l IsolationLevel) Proscribes(name string) bool {
+	switch name {
+	case "G0":
+		return l >= ReadUncommitted
+	case "G1a", "G1b", "G1c":
+		return l >= ReadCommitted
+	case "G-single":
+		return l >= SnapshotIsolation
+	case "G2-item":
+		return l >= Serializable
+	}
+	return false
+}
+
+// Dependency edge kinds between txes.
+const (
+	edgeWW = 1 << iota
+	edgeWR
+	edgeRW
+)
+
+var edgeNames = []struct {
+	kind int
+	name string
+}{
+	{edgeWW, "ww"},
+	{edgeWR, "wr"},
+	{edgeRW, "rw"},
+}
+
+// initTx is the pseudo tx-id for the writer of the initial values.
+const initTx = -1
+
+// depGraph holds the dependencies between committed txes in a history.
+type depGraph struct {
+	h *History
+
+	committed map[int]bool
+	aborted   map[int]bool
+
+	// writes holds the values written by each tx for each key in the order of
+	// the operations. Deletes are recorded as "os.ErrNotExist".
+	writes map[int]map[string][]string
+
+	// edges holds the kinds of edges from one tx to another.
+	edges map[int]map[int]int
+
+	phenomena []*Phenomenon
+}
+
+// CheckHistory builds the write-write, write-read and read-write dependency
+// graph between the committed txes in the history and returns the anomalies
+// found in it.
+//
+// Reads are attributed to writers by their values, so every write to a key is
+// expected to use a unique value; reads of a value written by more than one
+// tx are ignored. Version order of each key is inferred from the initial
+// values, from txes that read a key before writing it, and from the final
+// values. Txes with an unknown outcome (e.g., a timed out commit) are
+// considered as committed when any of their writes are observed.
+func CheckHistory(h *History) []*Phenomenon {
+	g := &depGraph{
+		h:         h,
+		committed: make(map[int]bool),
+		aborted:   make(map[int]bool),
+		writes:    make(map[int]map[string][]string),
+		edges:     make(map[int]map[int]int),
+	}
+	g.addWrites()
+	g.addEdges()
+	g.findCycles("G0", edgeWW, edgeWW)
+	g.findCycles("G1c", edgeWW|edgeWR, edgeWR)
+	g.findSingleCycles()
+	g.findCycles("G2-item", edgeWW|edgeWR|edgeRW, edgeRW)
+	return g.phenomena
+}
+
+// addWrites collects the outcome of every tx and the values written by them.
+func (g *depGraph) addWrites() {
+	for _, op := range g.h.Ops {
+		switch op.Type {
+		case "commit":
+			switch op.Status {
+			case StepSucceeded:
+				g.committed[op.Tx] = true
+			case StepFailed:
+				g.aborted[op.Tx] = true
+			}
+		case "abort":
+			g.aborted[op.Tx] = true
+		case "set", "delete":
+			if op.Status != StepSucceeded {
+				continue
+			}
+			v := op.Value
+			if op.Type == "delete" {
+				v = "os.ErrNotExist"
+			}
+			if g.writes[op.Tx] == nil {
+				g.writes[op.Tx] = make(map[string][]string)
+			}
+			g.writes[op.Tx][op.Key] = append(g.writes[op.Tx][op.Key], v)
+		}
+	}
+
+	// Writes of txes with an unknown outcome are visible only if they have
+	// committed.
+	for _, r := range g.reads() {
+		if tx, ok := g.writer(r.key, r.value, r.tx); ok && !g.aborted[tx] {
+			g.committed[tx] = true
+		}
+	}
+	for i, k := range g.h.Keys {
+		if i >= len(g.h.Final) {
+			break
+		}
+		if tx, ok := g.writer(k, g.h.Final[i], initTx); ok && tx != initTx && !g.aborted[tx] {
+			g.committed[tx] = true
+		}
+	}
+	for tx := range g.aborted {
+		delete(g.committed, tx)
+	}
+}
+
+// read is a value observed by a tx.
+type read struct {
+	tx    int
+	key   string
+	value string
+}
+
+// reads returns the reads of external values, i.e., reads of keys that were
+// not written earlier by the same tx.
+func (g *depGraph) reads() []read {
+	var reads []read
+	written := make(map[int]map[string]bool)
+	for _, op := range g.h.Ops {
+		if op.Status != StepSucceeded {
+			continue
+		}
+		if written[op.Tx] == nil {
+			written[op.Tx] = make(map[string]bool)
+		}
+		switch op.Type {
+		case "set", "delete":
+			written[op.Tx][op.Key] = true
+		case "get":
+			if !written[op.Tx][op.Key] {
+				reads = append(reads, read{op.Tx, op.Key, op.Value})
+			}
+		case "scan", "ascend", "descend":
+			for _, kv := range op.Range {
+				if !written[op.Tx][kv.Key] {
+					reads = append(reads, read{op.Tx, kv.Key, kv.Value})
+				}
+			}
+		}
+	}
+	return reads
+}
+
+// writer returns the tx that has written the value to the key, excluding the
+// given tx. Returns initTx for the initial value and false when the writer is
+// unknown or ambiguous.
+func (g *depGraph) writer(key, value string, exclude int) (int, bool) {
+	var found []int
+	for tx, kvs := range g.writes {
+		if tx == exclude {
+			continue
+		}
+		for _, v := range kvs[key] {
+			if v == value {
+				found = append(found, tx)
+				break
+			}
+		}
+	}
+	if i := g.keyIndex(key); i >= 0 && i < len(g.h.Initial) && g.h.Initial[i] == value {
+		found = append(found, initTx)
+	}
+	if len(found) != 1 {
+		return 0, false
+	}
+	return found[0], true
+}
+
+// lastWrite returns the final value written by the tx to the key.
+func (g *depGraph) lastWrite(tx int, key string) (string, bool) {
+	vs := g.writes[tx][key]
+	if len(vs) == 0 {
+		return "", false
+	}
+	return vs[len(vs)-1], true
+}
+
+func (g *depGraph) keyIndex(key string) int {
+	for i, k := range g.h.Keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// addEdges adds the dependency edges between committed txes and reports the
+// reads of aborted and intermediate values.
+func (g *depGraph) addEdges() {
+	// before holds the inferred version order for each key as a set of
+	// (earlier, later) writer pairs.
+	before := make(map[string]map[[2]int]bool)
+	order := func(key string, a, b int) {
+		if before[key] == nil {
+			before[key] = make(map[[2]int]bool)
+		}
+		before[key][[2]int{a, b}] = true
+	}
+
+	// writers holds the committed writers for each key.
+	writers := make(map[string][]int)
+	for _, tx := range g.sortedTxes() {
+		for key := range g.writes[tx] {
+			writers[key] = append(writers[key], tx)
+			order(key, initTx, tx)
+		}
+	}
+
+	type source struct {
+		read
+		writer int
+	}
+	var sources []source
+	for _, r := range g.reads() {
+		if !g.committed[r.tx] {
+			continue
+		}
+		w, ok := g.writer(r.key, r.value, r.tx)
+		if !ok {
+			continue
+		}
+		if w != initTx {
+			if g.aborted[w] {
+				g.report("G1a", []int{r.tx, w}, fmt.Sprintf("t%d read %s=%s written by aborted t%d", r.tx, r.key, r.value, w))
+				continue
+			}
+			if v, _ := g.lastWrite(w, r.key); v != r.value {
+				g.report("G1b", []int{r.tx, w}, fmt.Sprintf("t%d read %s=%s overwritten later by t%d", r.tx, r.key, r.value, w))
+				continue
+			}
+			if !g.committed[w] {
+				continue
+			}
+			g.addEdge(w, r.tx, edgeWR)
+		}
+		sources = append(sources, source{r, w})
+		// A tx that reads a key before writing it installs the next version.
+		if _, ok := g.lastWrite(r.tx, r.key); ok {
+			order(r.key, w, r.tx)
+		}
+	}
+
+	// Final value is the last version of the key.
+	for i, key := range g.h.Keys {
+		if i >= len(g.h.Final) {
+			break
+		}
+		last, ok := g.writer(key, g.h.Final[i], initTx)
+		if !ok || !g.committed[last] {
+			continue
+		}
+		for _, tx := range writers[key] {
+			if tx != last {
+				order(key, tx, last)
+			}
+		}
+	}
+
+	for key, pairs := range before {
+		closeOrder(pairs)
+		for p := range pairs {
+			if p[0] != initTx && p[0] != p[1] {
+				g.addEdge(p[0], p[1], edgeWW)
+			}
+		}
+		// A tx that has read a version depends on every later version.
+		for _, s := range sources {
+			if s.key != key {
+				continue
+			}
+			for _, tx := range writers[key] {
+				if tx != s.tx && pairs[[2]int{s.writer, tx}] {
+					g.addEdge(s.tx, tx, edgeRW)
+				}
+			}
+		}
+	}
+}
+
+// closeOrder adds the pairs implied by transitivity.
+func closeOrder(pairs map[[2]int]bool) {
+	for changed := true; changed; {
+		changed = false
+		for p := range pairs {
+			for q := range pairs {
+				if p[1] == q[0] && !pairs[[2]int{p[0], q[1]}] {
+					pairs[[2]int{p[0], q[1]}] = true
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// sortedTxes returns the committed txes in the increasing order.
+func (g *depGraph) sortedTxes() []int {
+	var txes []int
+	for tx := range g.committed {
+		txes = append(txes, tx)
+	}
+	sort.Ints(txes)
+	return txes
+}
+
+func (g *depGraph) addEdge(from, to, kind int) {
+	if g.edges[from] == nil {
+		g.edges[from] = make(map[int]int)
+	}
+	g.edges[from][to] |= kind
+}
+
+func (g *depGraph) report(name string, txes []int, desc string) {
+	g.phenomena = append(g.phenomena, &Phenomenon{Name: name, Txes: txes, Desc: desc})
+}
+
+// findCycles reports a cycle for every strongly connected component of the
+// graph restricted to the mask edges, which includes an edge of the required
+// kind.
+func (g *depGraph) findCycles(name string, mask, required int) {
+	for _, scc := range g.components(mask) {
+		if len(scc) < 2 {
+			continue
+		}
+		in := make(map[int]bool)
+		for _, tx := range scc {
+			in[tx] = true
+		}
+	search:
+		for _, from := range scc {
+			for _, to := range sortedKeys(g.edges[from]) {
+				if !in[to] || g.edges[from][to]&required == 0 {
+					continue
+				}
+				path := g.path(to, from, mask, in)
+				cycle := append([]int{from}, path...)
+				g.report(name, cycle, g.formatCycle(cycle, mask, required))
+				break search
+			}
+		}
+	}
+}
+
+// findSingleCycles reports a G-single cycle, which is a read-write
+// anti-dependency closed by write-write and write-read dependencies, in every
+// strongly connected component that has one.
+func (g *depGraph) findSingleCycles() {
+	all := edgeWW | edgeWR | edgeRW
+	for _, scc := range g.components(all) {
+		if len(scc) < 2 {
+			continue
+		}
+		in := make(map[int]bool)
+		for _, tx := range scc {
+			in[tx] = true
+		}
+	search:
+		for _, from := range scc {
+			for _, to := range sortedKeys(g.edges[from]) {
+				if !in[to] || g.edges[from][to]&edgeRW == 0 {
+					continue
+				}
+				path := g.path(to, from, edgeWW|edgeWR, in)
+				if path == nil {
+					continue
+				}
+				cycle := append([]int{from}, path...)
+				g.report("G-single", cycle, g.formatCycle(cycle, edgeWW|edgeWR, edgeRW))
+				break search
+			}
+		}
+	}
+}
+
+// components returns the strongly connected components of the graph
+// restricted to the mask edges, using Tarjan's algorithm.
+func (g *depGraph) components(mask int) [][]int {
+	index := make(map[int]int)
+	lowlink := make(map[int]int)
+	onStack := make(map[int]bool)
+	var stack []int
+	var sccs [][]int
+
+	var visit func(int)
+	visit = func(v int) {
+		index[v] = len(index)
+		lowlink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range sortedKeys(g.edges[v]) {
+			if g.edges[v][w]&mask == 0 {
+				continue
+			}
+			if _, ok := index[w]; !ok {
+				visit(w)
+				if lowlink[w] < lowlink[v] {
+					lowlink[v] = lowlink[w]
+				}
+			} else if onStack[w] && index[w] < lowlink[v] {
+				lowlink[v] = index[w]
+			}
+		}
+		if lowlink[v] == index[v] {
+			var scc []int
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				scc = append(scc, w)
+				if w == v {
+					break
+				}
+			}
+			sort.Ints(scc)
+			sccs = append(sccs, scc)
+		}
+	}
+	for _, tx := range g.sortedTxes() {
+		if _, ok := index[tx]; !ok {
+			visit(tx)
+		}
+	}
+	return sccs
+}
+
+// path returns the shortest path from one tx to another through the mask
+// edges between the given txes. Path includes the from tx, but not the to tx.
+// Returns nil if there is no such path.
+func (g *depGraph) path(from, to, mask int, in map[int]bool) []int {
+	prev := map[int]int{from: from}
+	queue := []int{from}
+	for len(queue) > 0 && queue[0] != to {
+		v := queue[0]
+		queue = queue[1:]
+		for _, w := range sortedKeys(g.edges[v]) {
+			if _, ok := prev[w]; ok || !in[w] || g.edges[v][w]&mask == 0 {
+				continue
+			}
+			prev[w] = v
+			queue = append(queue, w)
+		}
+	}
+	if _, ok := prev[to]; !ok {
+		return nil
+	}
+	var path []int
+	for v := prev[to]; ; v = prev[v] {
+		path = append([]int{v}, path...)
+		if v == from {
+			break
+		}
+	}
+	return path
+}
+
+// formatCycle describes the edges of a cycle, e.g., "t0 -ww-> t1 -wr-> t0".
+// First edge is labeled with the required kind.
+func (g *depGraph) formatCycle(cycle []int, mask, required int) string {
+	var sb strings.Builder
+	for i, from := range cycle {
+		to := cycle[(i+1)%len(cycle)]
+		kinds := g.edges[from][to] & mask
+		if i == 0 {
+			kinds = required
+		}
+		for _, e := range edgeNames {
+			if kinds&e.kind != 0 {
+				fmt.Fprintf(&sb, "t%d -%s-> ", from, e.name)
+				break
+			}
+		}
+	}
+	fmt.Fprintf(&sb, "t%d", cycle[0])
+	return sb.String()
+}
+
+func sortedKeys(m map[int]int) []int {
+	var keys []int
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
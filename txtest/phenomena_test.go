@@ -0,0 +1,126 @@
+package txtest
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testHistory builds a history over keys x and y, whose initial values are x0
+// and y0, from the operations in the order of completion.
+func testHistory(final []string, ops ...Op) *History {
+	h := &History{
+		Keys:    []string{"x", "y"},
+		Initial: []string{"x0", "y0"},
+		Final:   final,
+	}
+	for i, op := range ops {
+		op.Index, op.Line, op.Status = i, i, StepSucceeded
+		h.Ops = append(h.Ops, op)
+	}
+	return h
+}
+
+func getOp(tx int, key, value string) Op { return Op{Tx: tx, Type: "get", Key: key, Value: value} }
+func setOp(tx int, key, value string) Op { return Op{Tx: tx, Type: "set", Key: key, Value: value} }
+func commitOp(tx int) Op                 { return Op{Tx: tx, Type: "commit"} }
+func abortOp(tx int) Op                  { return Op{Tx: tx, Type: "abort"} }
+
+func TestCheckHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		h    *History
+		want []string
+	}{
+		{
+			name: "Serial",
+			h: testHistory([]string{"x1", "y1"},
+				getOp(0, "x", "x0"), setOp(0, "x", "x1"), commitOp(0),
+				getOp(1, "x", "x1"), setOp(1, "y", "y1"), commitOp(1)),
+		},
+		{
+			// Each tx overwrites the other's write on a different key.
+			name: "G0",
+			h: testHistory([]string{"x1", "y0a"},
+				setOp(0, "x", "x0a"), setOp(1, "x", "x1"),
+				setOp(1, "y", "y1"), setOp(0, "y", "y0a"),
+				commitOp(0), commitOp(1)),
+			want: []string{"G0"},
+		},
+		{
+			name: "G1a",
+			h: testHistory([]string{"x0", "y0"},
+				setOp(0, "x", "x1"), getOp(1, "x", "x1"),
+				abortOp(0), commitOp(1)),
+			want: []string{"G1a"},
+		},
+		{
+			name: "G1b",
+			h: testHistory([]string{"x2", "y0"},
+				setOp(0, "x", "x1"), getOp(1, "x", "x1"), setOp(0, "x", "x2"),
+				commitOp(0), commitOp(1)),
+			want: []string{"G1b"},
+		},
+		{
+			// Each tx reads the other's uncommitted write.
+			name: "G1c",
+			h: testHistory([]string{"x1", "y1"},
+				setOp(0, "x", "x1"), getOp(1, "x", "x1"),
+				setOp(1, "y", "y1"), getOp(0, "y", "y1"),
+				commitOp(0), commitOp(1)),
+			want: []string{"G1c"},
+		},
+		{
+			// Read skew: t0 reads x before and y after t1 updates both.
+			name: "G-single",
+			h: testHistory([]string{"x1", "y1"},
+				getOp(0, "x", "x0"),
+				setOp(1, "x", "x1"), setOp(1, "y", "y1"), commitOp(1),
+				getOp(0, "y", "y1"), commitOp(0)),
+			want: []string{"G-single", "G2-item"},
+		},
+		{
+			// Write skew has two anti-dependencies, so it is not G-single.
+			name: "G2-item",
+			h: testHistory([]string{"x1", "y1"},
+				getOp(0, "x", "x0"), getOp(0, "y", "y0"),
+				getOp(1, "x", "x0"), getOp(1, "y", "y0"),
+				setOp(0, "x", "x1"), setOp(1, "y", "y1"),
+				commitOp(0), commitOp(1)),
+			want: []string{"G2-item"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, p := range CheckHistory(test.h) {
+				got = append(got, p.Name)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("CheckHistory() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProscribes(t *testing.T) {
+	tests := []struct {
+		level IsolationLevel
+		want  []string
+	}{
+		{ReadUncommitted, []string{"G0"}},
+		{ReadCommitted, []string{"G0", "G1a", "G1b", "G1c"}},
+		{SnapshotIsolation, []string{"G0", "G1a", "G1b", "G1c", "G-single"}},
+		{Serializable, []string{"G0", "G1a", "G1b", "G1c", "G-single", "G2-item"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, name := range []string{"G0", "G1a", "G1b", "G1c", "G-single", "G2-item"} {
+			if test.level.Proscribes(name) {
+				got = append(got, name)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v proscribes %v, want %v", test.level, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package txtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bvkgo/kv"
+)
+
+// ErrNotSerializable is returned when the outcome of a test run doesn't match
+// the outcome of any serial execution of its committed txes.
+var ErrNotSerializable = errors.New("not serializable")
+
+// CheckSerializable verifies that the outcome of the most recent Run is
+// equivalent to some serial execution of the txes that were committed in that
+// run. Every serial order of the committed txes is run on the same keys
+// (which are reset to their initial values before each run) and the final
+// values, get results and scan results of the committed txes are compared
+// with the interleaved run.
+//
+// Returns nil if at least one serial order produces the same outcome.
+// Otherwise, returns an error wrapping ErrNotSerializable describing the
+// differences with the closest serial order.
+func (it *IsolationTest) CheckSerializable(ctx context.Context, newTx kv.NewTxFunc, newIt kv.NewIterFunc) error {
+	if it.keys == nil {
+		return fmt.Errorf("test must be run before the check: %w", os.ErrInvalid)
+	}
+	keys, values := it.Keys(), it.Values()
+	gets, scans := it.gets, it.scans
+
+	committed := it.committed()
+	var ctxes, atxes []int
+	for tx, ok := range committed {
+		if ok {
+			ctxes = append(ctxes, tx)
+		} else {
+			atxes = append(atxes, tx)
+		}
+	}
+	if len(ctxes) == 0 {
+		return nil
+	}
+
+	// Uncommitted txes are reduced to just begin and abort steps, so that they
+	// cannot affect the serial execution.
+	var rewritten []string
+	var rewrittenLines []int
+	for line, step := range it.steps {
+		ps, err := parseStep(step)
+		if err != nil {
+			return err
+		}
+		if ps.re == FinalRe {
+			continue
+		}
+		if committed[ps.tx] {
+			rewritten = append(rewritten, step)
+			rewrittenLines = append(rewrittenLines, line)
+			continue
+		}
+		switch ps.re {
+		case BeginRe, AbortRe:
+			rewritten = append(rewritten, step)
+			rewrittenLines = append(rewrittenLines, line)
+		case CommitRe:
+			rewritten = append(rewritten, fmt.Sprintf("t%d: abort", ps.tx))
+			rewrittenLines = append(rewrittenLines, line)
+		}
+	}
+
+	var (
+		closest []int
+		diffs   []string
+		errs    []string
+	)
+	for _, p := range sortedPermutations(len(ctxes)) {
+		var perm []int
+		for _, i := range p {
+			perm = append(perm, ctxes[i])
+		}
+		perm = append(perm, atxes...)
+
+		serial, lines := serialize(rewritten, perm)
+		st := &IsolationTest{
+			ntx:     it.ntx,
+			nkey:    it.nkey,
+			steps:   serial,
+			gets:    make(map[int]string),
+			scans:   make(map[int][]KeyValue),
+			values:  make([]string, it.nkey),
+			results: make([]error, it.ntx),
+		}
+		if _, err := st.Run(ctx, newTx, newIt, keys); err != nil {
+			errs = append(errs, fmt.Sprintf("serial order %s: %v", formatOrder(perm), err))
+			continue
+		}
+
+		var ds []string
+		for _, tx := range ctxes {
+			if st.results[tx] != nil {
+				ds = append(ds, fmt.Sprintf("t%d could not commit: %v", tx, st.results[tx]))
+			}
+		}
+		for line, index := range lines {
+			orig := rewrittenLines[index]
+			// Lines from the uncommitted txes are never compared.
+			if v, ok := gets[orig]; ok && committed[st.txAtLine(line)] {
+				if sv := st.gets[line]; sv != v {
+					ds = append(ds, fmt.Sprintf("get at line %d returned %q instead of %q", orig, v, sv))
+				}
+			}
+			if kvs, ok := scans[orig]; ok && committed[st.txAtLine(line)] {
+				if skvs := st.scans[line]; !equalKeyValues(kvs, skvs) {
+					ds = append(ds, fmt.Sprintf("scan at line %d returned %v instead of %v", orig, kvs, skvs))
+				}
+			}
+		}
+		for i := range values {
+			if values[i] != st.values[i] {
+				ds = append(ds, fmt.Sprintf("final value of k%d is %q instead of %q", i, values[i], st.values[i]))
+			}
+		}
+		if len(ds) == 0 {
+			return nil
+		}
+		if closest == nil || len(ds) < len(diffs) {
+			closest, diffs = perm, ds
+		}
+	}
+
+	if closest == nil {
+		return fmt.Errorf("could not run any serial order: %s", strings.Join(errs, "; "))
+	}
+	return fmt.Errorf("%w: closest serial order %s differs: %s", ErrNotSerializable, formatOrder(closest), strings.Join(diffs, "; "))
+}
+
+// committed returns true for the txes that were committed successfully in the
+// most recent run.
+func (it *IsolationTest) committed() []bool {
+	committed := make([]bool, it.ntx)
+	for line, step := range it.steps {
+		if ps, err := parseStep(step); err == nil && ps.re == CommitRe {
+			committed[ps.tx] = it.results[ps.tx] == nil && it.stepResults[line].Status == StepSucceeded
+		}
+	}
+	return committed
+}
+
+// txAtLine returns the tx-id for the step at the given index.
+func (it *IsolationTest) txAtLine(index int) int {
+	ps, err := parseStep(it.steps[index])
+	if err != nil {
+		panic(err) // Steps are validated when the test is created.
+	}
+	return ps.tx
+}
+
+func formatOrder(perm []int) string {
+	var ss []string
+	for _, tx := range perm {
+		ss = append(ss, fmt.Sprintf("t%d", tx))
+	}
+	return strings.Join(ss, ",")
+}
+
+func equalKeyValues(a, b []KeyValue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
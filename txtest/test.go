@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"sort"
+	"time"
 
 	"github.com/bvkgo/kv"
 )
@@ -28,6 +31,36 @@ type IsolationTest struct {
 	// gets holds the history of results for the get operation as a mapping from
 	// step index to the result.
 	gets map[int]string
+
+	// scans holds the history of results for the scan, ascend and descend
+	// operations as a mapping from step index to the key-value pairs in the
+	// iteration order.
+	scans map[int][]KeyValue
+
+	// concurrent is true when every tx runs on its own goroutine and
+	// blockWait is the duration after which a step is considered blocked.
+	concurrent bool
+	blockWait  time.Duration
+
+	// blocked holds the step indexes that were blocked in the concurrent mode.
+	blocked map[int]bool
+
+	// stepTimeout is the deadline for every step, if non-zero.
+	stepTimeout time.Duration
+
+	// stepResults holds the outcome of every executed step and nsteps is the
+	// number of steps completed so far.
+	stepResults map[int]StepResult
+	nsteps      int
+
+	// history holds every executed operation in the order of completion.
+	history []Op
+}
+
+// KeyValue holds a key-value pair returned by an iterator.
+type KeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
 }
 
 func NewIsolationTest(steps []string) (*IsolationTest, error) {
@@ -41,6 +74,7 @@ func NewIsolationTest(steps []string) (*IsolationTest, error) {
 		nkey:    nkey,
 		steps:   steps,
 		gets:    make(map[int]string),
+		scans:   make(map[int][]KeyValue),
 		values:  make([]string, nkey),
 		results: make([]error, ntx),
 	}
@@ -54,6 +88,21 @@ func (it *IsolationTest) GetResultAtLine(index int) string {
 	return ""
 }
 
+// ScanResultAtLine returns the key-value pairs observed by the scan, ascend or
+// descend step at the given index. Only the keys used by the test are
+// included, because all other keys are never modified by the steps.
+func (it *IsolationTest) ScanResultAtLine(index int) []KeyValue {
+	if kvs, ok := it.scans[index]; ok {
+		return append([]KeyValue{}, kvs...)
+	}
+	return nil
+}
+
+// Steps returns the steps of the test.
+func (it *IsolationTest) Steps() []string {
+	return append([]string{}, it.steps...)
+}
+
 func (it *IsolationTest) NumTx() int {
 	return it.ntx
 }
@@ -72,6 +121,23 @@ func (it *IsolationTest) NumSuccess() int {
 	return cnt
 }
 
+// Committed returns true for every tx that has committed successfully in the
+// most recent run.
+func (it *IsolationTest) Committed() []bool {
+	return it.committed()
+}
+
+// EndLine returns the index of the commit or abort step of the tx.
+func (it *IsolationTest) EndLine(tx int) int {
+	for line, step := range it.steps {
+		ps, err := parseStep(step)
+		if err == nil && ps.tx == tx && (ps.re == CommitRe || ps.re == AbortRe) {
+			return line
+		}
+	}
+	return -1
+}
+
 func (it *IsolationTest) Keys() []string {
 	return append([]string{}, it.keys...)
 }
@@ -84,9 +150,31 @@ func (it *IsolationTest) Results() []error {
 	return append([]error{}, it.results...)
 }
 
-func (it *IsolationTest) Run(ctx context.Context, newTx kv.NewTxFunc, keys []string) ([]string, error) {
-	if err := it.runSteps(ctx, newTx, keys); err != nil {
-		return nil, err
+// Run executes the steps using the given keys in place of the key ids. Keys
+// are expected to be in the sorted order (i.e., k0 < k1 < k2...) when the
+// steps use ascend or descend operations.
+func (it *IsolationTest) Run(ctx context.Context, newTx kv.NewTxFunc, newIt kv.NewIterFunc, keys []string) ([]string, error) {
+	if len(keys) < it.nkey {
+		return nil, fmt.Errorf("need %d keys, got %d: %w", it.nkey, len(keys), os.ErrInvalid)
+	}
+
+	// Reset results from any previous run.
+	it.gets = make(map[int]string)
+	it.scans = make(map[int][]KeyValue)
+	it.results = make([]error, it.ntx)
+	it.blocked = make(map[int]bool)
+	it.stepResults = make(map[int]StepResult)
+	it.nsteps = 0
+	it.history = nil
+
+	if it.concurrent {
+		if err := it.runConcurrent(ctx, newTx, newIt, keys); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := it.runSteps(ctx, newTx, newIt, keys); err != nil {
+			return nil, err
+		}
 	}
 	result, err := getKeys(ctx, newTx, keys)
 	if err != nil {
@@ -97,7 +185,7 @@ func (it *IsolationTest) Run(ctx context.Context, newTx kv.NewTxFunc, keys []str
 	return result, nil
 }
 
-func (it *IsolationTest) runSteps(ctx context.Context, newTx kv.NewTxFunc, keys []string) (status error) {
+func (it *IsolationTest) runSteps(ctx context.Context, newTx kv.NewTxFunc, newIt kv.NewIterFunc, keys []string) (status error) {
 	if err := clearKeys(ctx, newTx, keys); err != nil {
 		return fmt.Errorf("could not clear keys %v: %w", keys, err)
 	}
@@ -114,72 +202,189 @@ func (it *IsolationTest) runSteps(ctx context.Context, newTx kv.NewTxFunc, keys
 	}()
 
 	for line, step := range it.steps {
-		re, i, j, newvalue, err := parseStep(step)
+		ps, err := parseStep(step)
 		if err != nil {
 			return os.ErrInvalid
 		}
 
-		// Take the appropriate action.
-
-		if re == BeginRe {
-			tx, err := newTx(ctx)
-			if err != nil {
-				return fmt.Errorf("could not create tx %d: %w", i, err)
-			}
-			txes[i] = tx
+		// Final values are checked only after all steps are executed.
+		if ps.re == FinalRe {
 			continue
 		}
 
-		if re == GetRe {
-			v, err := txes[i].Get(ctx, keys[j])
-			if err != nil {
-				if !errors.Is(err, os.ErrNotExist) {
-					return fmt.Errorf("get in line %d failed: %w", line, err)
-				}
-				v = "os.ErrNotExist"
+		res := execStepWithTimeout(ctx, it.stepTimeout, newTx, newIt, &txes[ps.tx], ps, keys)
+		it.record(line, ps, res, keys)
+		switch ps.re {
+		case CommitRe, AbortRe:
+			it.results[ps.tx] = res.err
+		default:
+			if res.err != nil {
+				return fmt.Errorf("%s in line %d failed: %w", opName(ps.re), line, res.err)
 			}
-			// Add it to the get history.
-			it.gets[line] = v
-			continue
 		}
+	}
 
-		if re == SetRe {
-			if err := txes[i].Set(ctx, keys[j], newvalue); err != nil {
-				return fmt.Errorf("set in line %d failed: %w", line, err)
+	return it.checkCommits()
+}
+
+// checkCommits returns an error if no tx has committed, unless no tx has
+// tried to commit, e.g., when every tx ends with an abort step.
+func (it *IsolationTest) checkCommits() error {
+	tried := false
+	for _, step := range it.steps {
+		if ps, err := parseStep(step); err == nil && ps.re == CommitRe {
+			if it.results[ps.tx] == nil {
+				return nil
 			}
-			continue
+			tried = true
 		}
+	}
+	if tried {
+		return fmt.Errorf("all txes failed to commit")
+	}
+	return nil
+}
+
+// stepResult holds the outcome of a single step.
+type stepResult struct {
+	// get holds the result of a get operation.
+	get string
+
+	// scan holds the result of a scan, ascend or descend operation.
+	scan []KeyValue
+
+	// err is the error returned by the operation.
+	err error
 
-		if re == DeleteRe {
-			if err := txes[i].Delete(ctx, keys[j]); err != nil {
-				return fmt.Errorf("delete in line %d failed: %w", line, err)
+	// timedOut is true if the operation did not complete before its deadline.
+	timedOut bool
+
+	// invoke and complete hold the times when the operation was started and
+	// when it has returned or was abandoned.
+	invoke, complete time.Time
+}
+
+// execStep performs the operation for a step on the tx. Begin step creates a
+// new tx and commit or abort steps reset the tx to nil.
+func execStep(ctx context.Context, newTx kv.NewTxFunc, newIt kv.NewIterFunc, tx *kv.Transaction, ps *parsedStep, keys []string) (res stepResult) {
+	switch ps.re {
+	case BeginRe:
+		*tx, res.err = newTx(ctx)
+
+	case GetRe:
+		v, err := (*tx).Get(ctx, keys[ps.key])
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				res.err = err
+				break
 			}
-			continue
+			v = "os.ErrNotExist"
 		}
+		res.get = v
 
-		if re == AbortRe {
-			if err := txes[i].Discard(ctx); err != nil {
-				it.results[i] = err
-			}
-			txes[i] = nil
-			continue
+	case SetRe:
+		res.err = (*tx).Set(ctx, keys[ps.key], ps.value)
+
+	case DeleteRe:
+		// Deleting a key that doesn't exist is not an error, because whether
+		// the key exists depends on the order of the txes.
+		if err := (*tx).Delete(ctx, keys[ps.key]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			res.err = err
 		}
 
-		if re == CommitRe {
-			if err := txes[i].Commit(ctx); err != nil {
-				it.results[i] = err
-			}
-			txes[i] = nil
-			continue
+	case ScanRe, AscendRe, DescendRe:
+		iter, err := newIt(ctx)
+		if err != nil {
+			res.err = fmt.Errorf("could not create iterator: %w", err)
+			break
+		}
+		switch ps.re {
+		case ScanRe:
+			err = (*tx).Scan(ctx, iter)
+		case AscendRe:
+			err = (*tx).Ascend(ctx, keys[ps.key], keys[ps.end], iter)
+		case DescendRe:
+			err = (*tx).Descend(ctx, keys[ps.key], keys[ps.end], iter)
+		}
+		if err != nil {
+			res.err = err
+			break
+		}
+		kvs, err := collectKeys(ctx, iter, keys)
+		if err != nil {
+			res.err = fmt.Errorf("iteration failed: %w", err)
+			break
+		}
+		// Scan order is unspecified, so keep it deterministic.
+		if ps.re == ScanRe {
+			sort.Slice(kvs, func(a, b int) bool { return kvs[a].Key < kvs[b].Key })
+		}
+		res.scan = kvs
+
+	case AbortRe:
+		res.err = (*tx).Discard(ctx)
+		*tx = nil
+
+	case CommitRe:
+		res.err = (*tx).Commit(ctx)
+		*tx = nil
+	}
+	return res
+}
+
+// record adds the outcome of a step and the result of a get or scan step to
+// the history.
+func (it *IsolationTest) record(line int, ps *parsedStep, res stepResult, keys []string) {
+	sr := StepResult{
+		Status:  StepSucceeded,
+		Err:     res.err,
+		Blocked: it.blocked[line],
+		Seq:     it.nsteps,
+	}
+	it.nsteps++
+	if res.err != nil {
+		sr.Status = StepFailed
+		if res.timedOut {
+			sr.Status = StepTimedOut
 		}
 	}
+	it.stepResults[line] = sr
+	it.history = append(it.history, newOp(len(it.history), line, ps, res, sr.Status, keys))
+	if res.err != nil {
+		return
+	}
 
-	// At least one tx must succeed.
-	if it.NumSuccess() == 0 {
-		return fmt.Errorf("all txes failed to commit")
+	switch ps.re {
+	case GetRe:
+		it.gets[line] = res.get
+	case ScanRe, AscendRe, DescendRe:
+		it.scans[line] = res.scan
 	}
+}
 
-	return nil
+// opName returns the name of the operation for error messages.
+func opName(re *regexp.Regexp) string {
+	switch re {
+	case BeginRe:
+		return "begin"
+	case GetRe:
+		return "get"
+	case SetRe:
+		return "set"
+	case DeleteRe:
+		return "delete"
+	case ScanRe:
+		return "scan"
+	case AscendRe:
+		return "ascend"
+	case DescendRe:
+		return "descend"
+	case AbortRe:
+		return "abort"
+	case CommitRe:
+		return "commit"
+	}
+	return "unknown"
 }
 
 func clearKeys(ctx context.Context, newTx kv.NewTxFunc, keys []string) (status error) {
@@ -205,6 +410,30 @@ func clearKeys(ctx context.Context, newTx kv.NewTxFunc, keys []string) (status e
 	return nil
 }
 
+// collectKeys drains the iterator and returns the key-value pairs for only
+// the given keys in the iteration order.
+func collectKeys(ctx context.Context, iter kv.Iterator, keys []string) ([]KeyValue, error) {
+	keyset := make(map[string]struct{})
+	for _, k := range keys {
+		keyset[k] = struct{}{}
+	}
+
+	var kvs []KeyValue
+	for {
+		k, v, err := iter.GetNext(ctx)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			return nil, err
+		}
+		if _, ok := keyset[k]; ok {
+			kvs = append(kvs, KeyValue{Key: k, Value: v})
+		}
+	}
+	return kvs, nil
+}
+
 func getKeys(ctx context.Context, newTx kv.NewTxFunc, keys []string) (vs []string, status error) {
 	tx, err := newTx(ctx)
 	if err != nil {
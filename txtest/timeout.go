@@ -0,0 +1,136 @@
+package txtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bvkgo/kv"
+)
+
+// StepStatus describes how a step has ended.
+type StepStatus int
+
+const (
+	// StepNotRun is the status for steps that were not executed, because the
+	// run has stopped or an earlier step of the tx has failed.
+	StepNotRun StepStatus = iota
+
+	// StepSucceeded is the status for steps that have completed without an
+	// error.
+	StepSucceeded
+
+	// StepFailed is the status for steps that have returned an error.
+	StepFailed
+
+	// StepTimedOut is the status for steps that did not complete before their
+	// deadline or before they were canceled as deadlocked.
+	StepTimedOut
+)
+
+func (s StepStatus) String() string {
+	switch s {
+	case StepNotRun:
+		return "not-run"
+	case StepSucceeded:
+		return "succeeded"
+	case StepFailed:
+		return "failed"
+	case StepTimedOut:
+		return "timed-out"
+	}
+	return fmt.Sprintf("StepStatus(%d)", int(s))
+}
+
+func (s StepStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *StepStatus) UnmarshalText(text []byte) error {
+	for v := StepNotRun; v <= StepTimedOut; v++ {
+		if string(text) == v.String() {
+			*s = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown step status %q: %w", text, os.ErrInvalid)
+}
+
+// StepResult holds the outcome of a step.
+type StepResult struct {
+	Status StepStatus
+
+	// Err is the error returned by the step, if any.
+	Err error
+
+	// Blocked is true if the step didn't complete within the block wait
+	// duration in the concurrent mode. Blocked steps may complete later.
+	Blocked bool
+
+	// Seq is the position of the step in the order of completion. A blocked
+	// step that completes after another step has a larger Seq.
+	Seq int
+}
+
+// SetStepTimeout sets a deadline for every step, in addition to any deadline
+// on the context passed to Run. Steps that do not complete before the
+// deadline are abandoned, even when the backend doesn't honor the context, and
+// their tx is discarded once the step returns.
+//
+// In the sequential mode, a timed out operation fails the run, but a timed out
+// commit or abort fails only its tx.
+func (it *IsolationTest) SetStepTimeout(timeout time.Duration) {
+	it.stepTimeout = timeout
+}
+
+// StepResultAtLine returns the outcome of the step at the given index in the
+// most recent run.
+func (it *IsolationTest) StepResultAtLine(index int) StepResult {
+	return it.stepResults[index]
+}
+
+// execStepWithTimeout is similar to execStep, but gives up waiting for the
+// step when its deadline expires.
+func execStepWithTimeout(ctx context.Context, timeout time.Duration, newTx kv.NewTxFunc, newIt kv.NewIterFunc, tx *kv.Transaction, ps *parsedStep, keys []string) stepResult {
+	sctx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		sctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	// Step operates on a copy of the tx, so that an abandoned step cannot
+	// modify the caller's tx.
+	stx := *tx
+	invoke := time.Now()
+	ch := make(chan stepResult, 1)
+	go func() {
+		ch <- execStep(sctx, newTx, newIt, &stx, ps, keys)
+	}()
+
+	select {
+	case res := <-ch:
+		*tx = stx
+		if res.err != nil && sctx.Err() != nil {
+			res.timedOut = true
+		}
+		res.invoke, res.complete = invoke, time.Now()
+		return res
+	case <-sctx.Done():
+		// Tx cannot be used by the caller while the step is still running, so
+		// it is discarded when (and if) the step completes.
+		*tx = nil
+		go func() {
+			<-ch
+			if stx != nil {
+				_ = stx.Discard(context.Background())
+			}
+		}()
+		return stepResult{
+			err:      fmt.Errorf("step did not complete: %w", sctx.Err()),
+			timedOut: true,
+			invoke:   invoke,
+			complete: time.Now(),
+		}
+	}
+}
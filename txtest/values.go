@@ -0,0 +1,130 @@
+package txtest
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// quotedValue matches a value in the Go double-quoted string syntax, which
+// can be used for values with arbitrary bytes in the steps, e.g.,
+// `t0: set-k0-"\x00\xff"` or `t1: get-k0 => ""`.
+const quotedValue = `"(?:[^"\\]|\\.)*"`
+
+var plainValueRe = regexp.MustCompile(`^\w+$`)
+
+// QuoteValue returns the value in the form accepted by the steps, which is
+// the value itself when it has only word characters and a quoted string
+// otherwise.
+func QuoteValue(v string) string {
+	if plainValueRe.MatchString(v) {
+		return v
+	}
+	return strconv.Quote(v)
+}
+
+// unquoteValue returns the value for a value in the steps.
+func unquoteValue(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	v, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted value %s: %w", s, os.ErrInvalid)
+	}
+	return v, nil
+}
+
+// quotedLen returns the length of the quoted string at the beginning of s or
+// -1 if the string is not terminated.
+func quotedLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// cutExpect splits the step into the operation and the expected results at
+// the first ExpectSep outside of quoted values.
+func cutExpect(step string) (op, expect string, found bool) {
+	for i := 0; i < len(step); i++ {
+		if step[i] == '"' {
+			n := quotedLen(step[i:])
+			if n < 0 {
+				break
+			}
+			i += n - 1
+			continue
+		}
+		if strings.HasPrefix(step[i:], ExpectSep) {
+			return step[:i], step[i+len(ExpectSep):], true
+		}
+	}
+	return step, "", false
+}
+
+// splitValues splits a list of values separated by '|', where every value is
+// either a quoted string or a non-empty string without white space.
+func splitValues(s string) ([]string, error) {
+	var vs []string
+	for {
+		var v string
+		if strings.HasPrefix(s, `"`) {
+			n := quotedLen(s)
+			if n < 0 {
+				return nil, fmt.Errorf("unterminated quoted value: %w", os.ErrInvalid)
+			}
+			uv, err := unquoteValue(s[:n])
+			if err != nil {
+				return nil, err
+			}
+			v, s = uv, s[n:]
+			if len(s) > 0 && s[0] != '|' {
+				return nil, fmt.Errorf("unexpected %q after a quoted value: %w", s, os.ErrInvalid)
+			}
+		} else {
+			i := strings.IndexByte(s, '|')
+			if i < 0 {
+				i = len(s)
+			}
+			v, s = s[:i], s[i:]
+			if len(v) == 0 {
+				return nil, fmt.Errorf("expected result cannot be empty: %w", os.ErrInvalid)
+			}
+			if strings.IndexFunc(v, unicode.IsSpace) >= 0 || strings.ContainsRune(v, '"') {
+				return nil, fmt.Errorf("value %q must be quoted: %w", v, os.ErrInvalid)
+			}
+		}
+		vs = append(vs, v)
+		if len(s) == 0 {
+			return vs, nil
+		}
+		s = s[1:]
+	}
+}
+
+// abbrevValue returns a short, printable form of the value for messages.
+func abbrevValue(v string) string {
+	const max = 32
+	if len(v) <= max {
+		return strconv.Quote(v)
+	}
+	return fmt.Sprintf("%s...(%d bytes)", strconv.Quote(v[:max]), len(v))
+}
+
+// abbrevStep returns the step truncated to a short length for messages.
+func abbrevStep(step string) string {
+	const max = 80
+	if len(step) <= max {
+		return step
+	}
+	return step[:max] + "..."
+}
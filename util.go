@@ -2,9 +2,14 @@ package kvtests
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 )
 
+// FillItems stores Options.NumKeys keys with the values from the
+// Options.Values and verifies them by reading them back. Returns the smallest
+// and the largest keys.
 func FillItems(ctx context.Context, opts *Options) (string, string, error) {
 	nkeys := opts.NumKeys
 	tx, err := opts.NewTx(ctx)
@@ -12,13 +17,119 @@ func FillItems(ctx context.Context, opts *Options) (string, string, error) {
 		return "", "", err
 	}
 	for i := 0; i < nkeys; i++ {
-		s := opts.getKey(i)
-		if err := tx.Set(ctx, s, s); err != nil {
+		if err := tx.Set(ctx, opts.getKey(i), opts.getValue(i)); err != nil {
 			return "", "", err
 		}
 	}
 	if err := tx.Commit(ctx); err != nil {
 		return "", "", fmt.Errorf("could not fill the db: %w", err)
 	}
+	if err := verifyValues(ctx, opts); err != nil {
+		return "", "", err
+	}
 	return opts.getKey(0), opts.getKey(nkeys - 1), nil
 }
+
+// deleteKeys removes the given keys from the database in a single tx. Keys
+// that do not exist are ignored.
+func deleteKeys(ctx context.Context, opts *Options, keys ...string) (status error) {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if status != nil {
+			_ = tx.Discard(ctx)
+		}
+	}()
+
+	for _, k := range keys {
+		if err := tx.Delete(ctx, k); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("could not delete keys: %w", err)
+	}
+	return nil
+}
+
+// Teardown deletes the keys created by FillItems and verifies that no other
+// keys with the Options.Prefix are left behind. Leftover keys are reported as
+// leaks, but are not deleted, because they may not belong to the tests. Leaks
+// are not checked when the prefix is empty, because the namespace would be
+// the whole database.
+func Teardown(ctx context.Context, opts *Options) error {
+	if err := opts.Check(); err != nil {
+		return err
+	}
+	keys := make([]string, 0, opts.NumKeys)
+	for i := 0; i < opts.NumKeys; i++ {
+		keys = append(keys, opts.getKey(i))
+	}
+	if err := deleteKeys(ctx, opts, keys...); err != nil {
+		return err
+	}
+	if opts.Prefix == "" {
+		return nil
+	}
+
+	leaks, err := namespaceKeys(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("could not scan the keys with prefix %q: %w", opts.Prefix, err)
+	}
+	if len(leaks) > 0 {
+		const maxShown = 10
+		shown := leaks
+		if len(shown) > maxShown {
+			shown = shown[:maxShown]
+		}
+		return fmt.Errorf("%d keys with prefix %q are left behind: %q", len(leaks), opts.Prefix, shown)
+	}
+	return nil
+}
+
+// namespaceKeys returns all keys with the Options.Prefix.
+func namespaceKeys(ctx context.Context, opts *Options) (keys []string, status error) {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := tx.Discard(ctx); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	begin, end := opts.ascendRange()
+	keys, err = ascendKeys(ctx, opts, tx, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// runWithTeardown runs the test function and, when Options.Teardown is set,
+// deletes the test keys afterwards. Teardown errors are reported only when
+// the test has passed.
+func runWithTeardown(ctx context.Context, opts *Options, fn func(context.Context, *Options) error) error {
+	err := fn(ctx, opts)
+	if opts.Teardown {
+		if terr := Teardown(ctx, opts); terr != nil && err == nil {
+			err = fmt.Errorf("teardown failed: %w", terr)
+		}
+	}
+	return err
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
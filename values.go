@@ -0,0 +1,92 @@
+package kvtests
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+// ValueGenerator describes the values stored by FillItems.
+type ValueGenerator struct {
+	// Sizes holds the value sizes in bytes, one of which is chosen with equal
+	// probability for every value. Sizes can be repeated to choose some sizes
+	// more often, e.g., []int{0, 1, 16, 16, 16, 4 << 20}. All values are
+	// written in a single tx, so large sizes should be rare.
+	Sizes []int
+
+	// Alphabet holds the bytes used in the values. All 256 byte values are
+	// used when empty.
+	Alphabet []byte
+}
+
+func (g *ValueGenerator) check() error {
+	if len(g.Sizes) == 0 {
+		return fmt.Errorf("at least one value size is required: %w", os.ErrInvalid)
+	}
+	for _, n := range g.Sizes {
+		if n < 0 {
+			return fmt.Errorf("value size %d cannot be negative: %w", n, os.ErrInvalid)
+		}
+	}
+	return nil
+}
+
+// value returns a random value using the source of randomness.
+func (g *ValueGenerator) value(r *rand.Rand) string {
+	b := make([]byte, g.Sizes[r.Intn(len(g.Sizes))])
+	if len(g.Alphabet) == 0 {
+		_, _ = r.Read(b)
+		return string(b)
+	}
+	for i := range b {
+		b[i] = g.Alphabet[r.Intn(len(g.Alphabet))]
+	}
+	return string(b)
+}
+
+// getValue returns the value stored by FillItems for the key at index i,
+// which is the key itself when Options.Values is nil. Values depend only on
+// the Seed and the index, so they can be generated again for verification.
+func (opts *Options) getValue(i int) string {
+	if opts.Values == nil {
+		return opts.getKey(i)
+	}
+	return opts.Values.value(rand.New(rand.NewSource(opts.Seed + int64(i))))
+}
+
+// verifyValues reads back every key stored by FillItems in a new tx and
+// compares its value byte-by-byte with the value that was written.
+func verifyValues(ctx context.Context, opts *Options) (status error) {
+	tx, err := opts.NewTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Discard(ctx); err != nil && status == nil {
+			status = err
+		}
+	}()
+
+	for i := 0; i < opts.NumKeys; i++ {
+		key := opts.getKey(i)
+		got, err := tx.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("could not read back key %q: %w", key, err)
+		}
+		if want := opts.getValue(i); got != want {
+			return fmt.Errorf("value of key %q is not the value written: %s", key, diffValues(got, want))
+		}
+	}
+	return nil
+}
+
+// diffValues describes the first difference between two values.
+func diffValues(got, want string) string {
+	for i := 0; i < len(got) && i < len(want); i++ {
+		if got[i] != want[i] {
+			return fmt.Sprintf("byte %d is 0x%02x instead of 0x%02x (got %d bytes, want %d bytes)", i, got[i], want[i], len(got), len(want))
+		}
+	}
+	return fmt.Sprintf("got %d bytes, want %d bytes", len(got), len(want))
+}